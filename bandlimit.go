@@ -0,0 +1,42 @@
+package mlsic
+
+import "math"
+
+// BandLimit keeps partials below a frequency ceiling so they do not alias.
+// The same policy is used by every package rendering partials.
+type BandLimit struct {
+	// Ceiling is the frequency above which partials are silent.
+	Ceiling float64
+	// RollOff is the width in Hz of the band below Ceiling in which the amplitude
+	// of partials fades out, so that they do not pop in and out as their
+	// fundamental moves. Zero cuts them off at the ceiling.
+	RollOff float64
+}
+
+// NewBandLimit returns a BandLimit without roll-off and its ceiling
+// at MaxFrequency, or at the Nyquist frequency of sampleRate if lower.
+func NewBandLimit(sampleRate int) BandLimit {
+	return BandLimit{
+		Ceiling: math.Min(MaxFrequency, Nyquist(sampleRate)),
+	}
+}
+
+// Nyquist returns the Nyquist frequency, half the sample rate.
+func Nyquist(sampleRate int) float64 {
+	return float64(sampleRate) / 2
+}
+
+// Gain returns the amplitude factor of a partial sounding at frequency,
+// from 1 below the roll-off band down to 0 above the ceiling.
+func (b BandLimit) Gain(frequency float64) float64 {
+	switch {
+	case frequency > b.Ceiling:
+		return 0
+
+	case frequency <= b.Ceiling-b.RollOff:
+		return 1
+	}
+
+	// Raised cosine from the start of the roll-off band to the ceiling.
+	return .5 - .5*math.Cos(math.Pi*(b.Ceiling-frequency)/b.RollOff)
+}
@@ -16,6 +16,7 @@ func main() {
 	filesPath := flag.String("files", "", "sets the directory audio files will be saved")
 	modelsPath := flag.String("models", "", "sets the directory model files will be saved")
 	seedModelPath := flag.String("seed", "", "sets the directory of seed model to use")
+	sampleRate := flag.Int("rate", mlsic.SampleRate, "sets the sampling rate")
 
 	flag.Parse()
 
@@ -33,10 +34,13 @@ func main() {
 		FilePath:      *filesPath,
 		ModelsPath:    *modelsPath,
 		SeedModelPath: *seedModelPath,
+		SampleRate:    *sampleRate,
 		Harmonics:     &naive{},
 	}
 
-	s.NGen()
+	if err := s.NGen(); err != nil {
+		log.Fatal().Err(err).Msg("ngen")
+	}
 }
 
 var _ mlsic.Harmonics = (*naive)(nil)
@@ -1,7 +1,47 @@
 package main
 
-import "github.com/rs/zerolog/log"
+import (
+	"flag"
+	"os"
+
+	"github.com/bh90210/mlsic"
+	"github.com/bh90210/mlsic/markov"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
 
 func main() {
-	log.Info().Msg("in dev")
+	debug := flag.Bool("debug", false, "sets log level to debug")
+	ngenerations := flag.Int("ngen", 2, "sets the number of generations")
+	filesPath := flag.String("files", "", "sets the directory audio files will be saved")
+	modelsPath := flag.String("models", "", "sets the directory model files will be saved")
+	seedModelPath := flag.String("seed", "", "sets the directory of seed model to use")
+	sampleRate := flag.Int("rate", mlsic.SampleRate, "sets the sampling rate")
+	speakers := flag.Int("speakers", mlsic.TwoSpeakers, "sets the number of speakers")
+	events := flag.Int("events", markov.DefaultMaxEvents, "sets the maximum number of events of a generation")
+
+	flag.Parse()
+
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	if *debug {
+		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	}
+
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+
+	// Init a polyphonic markov song.
+	s := markov.Song{
+		NGenerations:  *ngenerations,
+		FilePath:      *filesPath,
+		ModelsPath:    *modelsPath,
+		SeedModelPath: *seedModelPath,
+		SampleRate:    *sampleRate,
+		Layout:        mlsic.Speakers(*speakers),
+		MaxEvents:     *events,
+	}
+
+	if err := s.PolyGen(); err != nil {
+		log.Fatal().Err(err).Msg("polygen")
+	}
 }
@@ -0,0 +1,119 @@
+package mlsic
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Curve is a value changing over time, like the panning of a moving tone.
+type Curve interface {
+	// At returns the value of the curve at time t from its start.
+	At(t time.Duration) float64
+}
+
+// CurveFunc is an adapter to use ordinary functions as a Curve.
+type CurveFunc func(t time.Duration) float64
+
+// At implements Curve.
+func (f CurveFunc) At(t time.Duration) float64 {
+	return f(t)
+}
+
+// Breakpoint is the value of a Breakpoints curve at a point in time.
+type Breakpoint struct {
+	Time  time.Duration
+	Value float64
+	// Curvature of the segment leading to the breakpoint. Zero is a straight line.
+	// Positive values give exponential segments that start slowly and end fast,
+	// negative values ones that start fast and end slowly.
+	Curvature float64
+}
+
+// Breakpoints is a Curve interpolating between breakpoints sorted by time.
+// Before the first breakpoint it holds the first value and after the last one the last value.
+// As an Envelope the times are from the start of the signal.
+type Breakpoints []Breakpoint
+
+// At implements Curve.
+func (b Breakpoints) At(t time.Duration) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+
+	// The first breakpoint after t.
+	i := sort.Search(len(b), func(i int) bool {
+		return b[i].Time > t
+	})
+
+	switch i {
+	case 0:
+		return b[0].Value
+
+	case len(b):
+		return b[len(b)-1].Value
+	}
+
+	from, to := b[i-1], b[i]
+
+	x := float64(t-from.Time) / float64(to.Time-from.Time)
+	if to.Curvature != 0 {
+		x = (1 - math.Exp(to.Curvature*x)) / (1 - math.Exp(to.Curvature))
+	}
+
+	return from.Value + (to.Value-from.Value)*x
+}
+
+// Gain implements Envelope.
+func (b Breakpoints) Gain(t, _ time.Duration) float64 {
+	return b.At(t)
+}
+
+// Envelope shapes the amplitude of a signal over its duration.
+type Envelope interface {
+	// Gain returns the ratio to multiply the signal at time t from its start,
+	// for a signal lasting duration.
+	Gain(t, duration time.Duration) float64
+}
+
+// ADSR is an attack, decay, sustain and release Envelope. The release
+// ends with the signal so the signal starts and ends in silence.
+type ADSR struct {
+	// Attack is the time it takes to rise from silence to full amplitude.
+	Attack time.Duration
+	// Decay is the time it takes to fall from full amplitude to the sustain level.
+	Decay time.Duration
+	// Sustain is the level, from zero to one, held until the release.
+	Sustain float64
+	// Release is the time it takes to fade out at the end of the signal.
+	Release time.Duration
+}
+
+// Gain implements Envelope. If the signal is shorter than the stages
+// of the envelope the release fades out whatever level has been reached.
+func (e ADSR) Gain(t, duration time.Duration) float64 {
+	var gain float64
+	switch {
+	case t < e.Attack:
+		gain = float64(t) / float64(e.Attack)
+
+	case t < e.Attack+e.Decay:
+		gain = 1 - (1-e.Sustain)*float64(t-e.Attack)/float64(e.Decay)
+
+	default:
+		gain = e.Sustain
+	}
+
+	if remaining := duration - t; remaining < e.Release {
+		gain *= math.Max(0, float64(remaining)/float64(e.Release))
+	}
+
+	return gain
+}
+
+// ApplyEnvelope multiplies signal, lasting duration, by envelope.
+func ApplyEnvelope(signal Audio, envelope Envelope, duration time.Duration, sampleRate int) {
+	for i := range signal {
+		signal[i] *= envelope.Gain(SamplesInDuration(i, sampleRate), duration)
+	}
+}
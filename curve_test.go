@@ -0,0 +1,84 @@
+package mlsic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakpoints(t *testing.T) {
+	a := assert.New(t)
+
+	curve := Breakpoints{
+		{Time: 10 * time.Millisecond, Value: 0},
+		{Time: 20 * time.Millisecond, Value: 1},
+		{Time: 40 * time.Millisecond, Value: 0.5},
+	}
+
+	a.Equal(0., curve.At(0))
+	a.Equal(0., curve.At(10*time.Millisecond))
+	a.Equal(0.5, curve.At(15*time.Millisecond))
+	a.Equal(1., curve.At(20*time.Millisecond))
+	a.Equal(0.75, curve.At(30*time.Millisecond))
+	a.Equal(0.5, curve.At(time.Second))
+
+	a.Zero(Breakpoints{}.At(time.Second))
+}
+
+func TestCurveFunc(t *testing.T) {
+	var curve Curve = CurveFunc(func(t time.Duration) float64 {
+		return t.Seconds()
+	})
+
+	assert.Equal(t, 0.5, curve.At(500*time.Millisecond))
+}
+
+func TestBreakpointsCurvature(t *testing.T) {
+	a := assert.New(t)
+
+	curve := Breakpoints{
+		{Time: 0, Value: 1},
+		{Time: 10 * time.Millisecond, Value: 0, Curvature: -4},
+		{Time: 20 * time.Millisecond, Value: 1, Curvature: 4},
+	}
+
+	a.InDelta(1., curve.At(0), 1e-9)
+	a.InDelta(0., curve.At(10*time.Millisecond), 1e-9)
+	a.InDelta(1., curve.At(20*time.Millisecond), 1e-9)
+
+	// Fast fall then slow, slow rise then fast.
+	a.Less(curve.At(2*time.Millisecond), 0.5)
+	a.Less(curve.At(15*time.Millisecond), 0.5)
+
+	// Envelopes ignore the duration.
+	a.Equal(curve.At(5*time.Millisecond), curve.Gain(5*time.Millisecond, time.Hour))
+}
+
+func TestADSR(t *testing.T) {
+	a := assert.New(t)
+
+	env := ADSR{
+		Attack:  10 * time.Millisecond,
+		Decay:   10 * time.Millisecond,
+		Sustain: 0.5,
+		Release: 20 * time.Millisecond,
+	}
+
+	duration := 100 * time.Millisecond
+
+	a.Equal(0., env.Gain(0, duration))
+	a.Equal(0.5, env.Gain(5*time.Millisecond, duration))
+	a.Equal(1., env.Gain(10*time.Millisecond, duration))
+	a.Equal(0.75, env.Gain(15*time.Millisecond, duration))
+	a.Equal(0.5, env.Gain(50*time.Millisecond, duration))
+	a.Equal(0.25, env.Gain(90*time.Millisecond, duration))
+	a.Equal(0., env.Gain(duration, duration))
+
+	// Shorter than the envelope, the release fades out from the attack.
+	a.InDelta(0.5*0.25, env.Gain(5*time.Millisecond, 10*time.Millisecond), 1e-9)
+
+	signal := Audio{1, 1, 1, 1, 1}
+	ApplyEnvelope(signal, ADSR{Attack: SamplesInDuration(4, SampleRate), Sustain: 1}, SamplesInDuration(5, SampleRate), SampleRate)
+	a.InDeltaSlice(Audio{0, 0.25, 0.5, 0.75, 1}, signal, 1e-4)
+}
@@ -8,7 +8,6 @@ require (
 	github.com/go-audio/aiff v1.0.0
 	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/generator v0.0.0-20191129013639-fe5438877d8c
-	github.com/go-audio/transforms v0.0.0-20180121090939-51830ccc35a5
 	github.com/go-audio/wav v1.1.0
 	github.com/gordonklaus/portaudio v0.0.0-20220320131553-cc649ad523c1
 	github.com/mb-14/gomarkov v0.0.0-20231120193207-9cbdc8df67a8
@@ -23,7 +22,5 @@ require (
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.12.0 // indirect
-	golang.org/x/tools v0.5.1-0.20230111220935-a7f7db3f17fc // indirect
-	golang.org/x/tools/cmd/cover v0.1.0-deprecated // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,208 @@
+package mlsic
+
+import (
+	"math"
+	"sort"
+)
+
+// Speaker is the position of a speaker on the horizontal plane. The listener is at the origin
+// facing the positive Y axis, with the positive X axis on their right.
+type Speaker struct {
+	X float64
+	Y float64
+}
+
+// Azimuth returns the angle of the speaker in degrees, clockwise from the front of the listener,
+// from 0 up to 360.
+func (s Speaker) Azimuth() float64 {
+	return clockwise(0, math.Atan2(s.X, s.Y)*180/math.Pi)
+}
+
+// speakerAt returns a speaker one meter away from the listener at azimuth.
+func speakerAt(azimuth float64) Speaker {
+	rad := azimuth * math.Pi / 180
+	return Speaker{
+		X: math.Sin(rad),
+		Y: math.Cos(rad),
+	}
+}
+
+// Layout is the arrangement of the speakers signals are panned to.
+//
+// In a closed layout, like a ring, the speakers surround the listener and the panning value
+// of a signal is its azimuth as a fraction of a full circle, so 0.25 is on the right of the listener.
+// A signal is panned between the two speakers enclosing it, wrapping from the last speaker to the first.
+//
+// In an open layout, like a stereo pair, panning 0 is the azimuth of the first speaker, 1 the azimuth
+// of the last speaker and the values in between sweep clockwise from one to the other.
+type Layout struct {
+	// Speakers in the order of the channels they are played from.
+	Speakers []Speaker
+	// Open layouts do not wrap from the last speaker back to the first.
+	Open bool
+	// PanLaw crossfades a signal between the two speakers enclosing it, by the fraction
+	// of the angle between the speakers the signal is at. Its stereo gains are used.
+	// If not set LinearPanLaw is used.
+	PanLaw PanLaw
+	// VBAP pans a signal between the two speakers enclosing it with vector base
+	// amplitude panning, taking their actual positions into account, instead of PanLaw.
+	VBAP bool
+}
+
+// Mono returns a layout of a single speaker in front of the listener.
+func Mono() Layout {
+	return Layout{
+		Speakers: []Speaker{speakerAt(0)},
+		Open:     true,
+	}
+}
+
+// Stereo returns an open layout of a left and a right speaker 30 degrees off the front
+// of the listener. Panning 0 is the left speaker and 1 the right one.
+func Stereo() Layout {
+	return Layout{
+		Speakers: []Speaker{speakerAt(-30), speakerAt(30)},
+		Open:     true,
+	}
+}
+
+// Ring returns a closed layout of n speakers evenly spaced around the listener.
+// Speaker i is centered at panning (i + 0.5) / n, so the first speaker's range
+// starts right in front of the listener.
+func Ring(n int) Layout {
+	speakers := make([]Speaker, n)
+	for i := range speakers {
+		speakers[i] = speakerAt((float64(i) + 0.5) / float64(n) * 360)
+	}
+
+	return Layout{
+		Speakers: speakers,
+	}
+}
+
+// Speakers returns Mono, Stereo or Ring layouts for 1, 2 or more speakers respectively.
+func Speakers(noOfSpeakers int) Layout {
+	switch noOfSpeakers {
+	case OneSpeaker:
+		return Mono()
+
+	case TwoSpeakers:
+		return Stereo()
+
+	default:
+		return Ring(noOfSpeakers)
+	}
+}
+
+// Len returns the number of speakers.
+func (l Layout) Len() int {
+	return len(l.Speakers)
+}
+
+// Gains returns the ratios to multiply a signal at panning for each one of the speakers.
+// If gains has room for all speakers it is used instead of allocating a new slice.
+func (l Layout) Gains(panning float64, gains []float64) []float64 {
+	if cap(gains) < len(l.Speakers) {
+		gains = make([]float64, len(l.Speakers))
+	}
+
+	gains = gains[:len(l.Speakers)]
+	clear(gains)
+
+	switch len(l.Speakers) {
+	case 0:
+		return gains
+
+	case 1:
+		gains[0] = 1
+		return gains
+	}
+
+	// Azimuths of the speakers and the signal are measured from the start of the layout.
+	var start, span, source float64
+	if l.Open {
+		start = l.Speakers[0].Azimuth()
+		span = clockwise(start, l.Speakers[len(l.Speakers)-1].Azimuth())
+		source = math.Max(0, math.Min(1, panning)) * span
+	} else {
+		span = 360
+		source = clockwise(0, panning*360)
+	}
+
+	type speaker struct {
+		number int
+		offset float64
+	}
+
+	var speakers []speaker
+	for i, s := range l.Speakers {
+		offset := clockwise(start, s.Azimuth())
+		// Speakers outside an open layout's span are left silent.
+		if l.Open && offset > span {
+			continue
+		}
+
+		speakers = append(speakers, speaker{number: i, offset: offset})
+	}
+
+	sort.SliceStable(speakers, func(i, j int) bool {
+		return speakers[i].offset < speakers[j].offset
+	})
+
+	if len(speakers) == 1 {
+		gains[speakers[0].number] = 1
+		return gains
+	}
+
+	// Find the pair of adjacent speakers enclosing the signal.
+	first := len(speakers) - 1
+	for i, s := range speakers {
+		if s.offset > source {
+			break
+		}
+
+		first = i
+	}
+
+	// In an open layout the signal can only be past the last speaker because of rounding.
+	if l.Open && first == len(speakers)-1 {
+		first--
+	}
+
+	a, b := speakers[first], speakers[(first+1)%len(speakers)]
+
+	between := clockwise(a.offset, b.offset)
+	if !l.Open && between == 0 {
+		// A single position in a closed layout spans the whole circle.
+		between = 360
+	}
+
+	var fraction float64
+	if between > 0 {
+		fraction = clockwise(a.offset, source) / between
+	}
+
+	var ga, gb float64
+	switch {
+	case l.VBAP:
+		ga, gb = vbapPair(start+a.offset, start+b.offset, start+source)
+
+	default:
+		law := l.PanLaw
+		if law == nil {
+			law = LinearPanLaw
+		}
+
+		ga, gb = law(TwoSpeakers, Speaker1, fraction), law(TwoSpeakers, Speaker2, fraction)
+	}
+
+	gains[a.number] += ga
+	gains[b.number] += gb
+
+	return gains
+}
+
+// clockwise returns the angle in degrees from azimuth from to azimuth to, turning clockwise.
+func clockwise(from, to float64) float64 {
+	return math.Mod(math.Mod(to-from, 360)+360, 360)
+}
@@ -0,0 +1,90 @@
+package mlsic
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpeakerAzimuth(t *testing.T) {
+	a := assert.New(t)
+
+	a.InDelta(0., Speaker{X: 0, Y: 1}.Azimuth(), 1e-9)
+	a.InDelta(90., Speaker{X: 2, Y: 0}.Azimuth(), 1e-9)
+	a.InDelta(180., Speaker{X: 0, Y: -1}.Azimuth(), 1e-9)
+	a.InDelta(270., Speaker{X: -1, Y: 0}.Azimuth(), 1e-9)
+}
+
+func TestLayoutGains(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal([]float64{1}, Mono().Gains(0.3, nil))
+	a.Empty(Layout{}.Gains(0.3, nil))
+
+	stereo := Stereo()
+	a.InDeltaSlice([]float64{1, 0}, stereo.Gains(0, nil), 1e-9)
+	a.InDeltaSlice([]float64{0.5, 0.5}, stereo.Gains(0.5, nil), 1e-9)
+	a.InDeltaSlice([]float64{0.25, 0.75}, stereo.Gains(0.75, nil), 1e-9)
+	a.InDeltaSlice([]float64{0, 1}, stereo.Gains(1, nil), 1e-9)
+	a.InDeltaSlice([]float64{0, 1}, stereo.Gains(1.5, nil), 1e-9)
+
+	stereo.PanLaw = EqualPowerPanLaw
+	a.InDeltaSlice([]float64{math.Sqrt2 / 2, math.Sqrt2 / 2}, stereo.Gains(0.5, nil), 1e-9)
+
+	// A given slice is reused.
+	gains := make([]float64, 0, 2)
+	a.Equal(2, len(Stereo().Gains(0.1, gains)))
+	a.InDelta(0.9, gains[:2][0], 1e-9)
+}
+
+func TestRingGains(t *testing.T) {
+	a := assert.New(t)
+
+	// A ring of four matches Panning.
+	ring := Ring(4)
+	for _, panning := range []float64{0, 0.05, 0.125, 0.3, 0.4, 0.55, 0.875, 0.88, 0.99, 1} {
+		gains := ring.Gains(panning, nil)
+		for speaker, gain := range gains {
+			a.InDelta(Panning(4, speaker, panning), gain, 1e-9, "%v %v", panning, speaker)
+		}
+	}
+
+	// Eight speakers wrap continuously around 0 and 1.
+	ring = Ring(8)
+	a.InDeltaSlice(ring.Gains(0, nil), ring.Gains(1, nil), 1e-9)
+	a.InDeltaSlice([]float64{0.5, 0, 0, 0, 0, 0, 0, 0.5}, ring.Gains(0, nil), 1e-9)
+	a.InDeltaSlice(ring.Gains(0.999999, nil), ring.Gains(0.000001, nil), 1e-4)
+
+	for panning := 0.; panning <= 1; panning += 0.01 {
+		var sum float64
+		for _, gain := range ring.Gains(panning, nil) {
+			sum += gain
+		}
+
+		a.InDelta(1., sum, 1e-9, panning)
+	}
+}
+
+func TestArbitraryLayoutGains(t *testing.T) {
+	a := assert.New(t)
+
+	// An irregular 5.0 layout, in L R C Ls Rs channel order.
+	layout := Layout{
+		Speakers: []Speaker{speakerAt(-30), speakerAt(30), speakerAt(0), speakerAt(-110), speakerAt(110)},
+		VBAP:     true,
+	}
+
+	// On a speaker.
+	a.InDeltaSlice([]float64{0, 0, 1, 0, 0}, layout.Gains(0, nil), 1e-9)
+	a.InDeltaSlice([]float64{0, 0, 0, 0, 1}, layout.Gains(110./360, nil), 1e-9)
+
+	// Between the surround speakers, behind the listener.
+	a.InDeltaSlice([]float64{0, 0, 0, math.Sqrt2 / 2, math.Sqrt2 / 2}, layout.Gains(0.5, nil), 1e-9)
+
+	// Between right and right surround, leaning to the right.
+	gains := layout.Gains(60./360, nil)
+	a.Zero(gains[0])
+	a.Greater(gains[1], gains[4])
+	a.InDelta(1., gains[1]*gains[1]+gains[4]*gains[4], 1e-9)
+}
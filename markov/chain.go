@@ -0,0 +1,228 @@
+package markov
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/mb-14/gomarkov"
+)
+
+// Chain is a Markov chain the fields of a Model are trained on.
+// *gomarkov.Chain and *Backoff implement it.
+type Chain interface {
+	Add(input []string)
+	GenerateDeterministic(current gomarkov.NGram, prng gomarkov.PRNG) (string, error)
+	MarshalJSON() ([]byte, error)
+	UnmarshalJSON(b []byte) error
+}
+
+var (
+	_ Chain = (*gomarkov.Chain)(nil)
+	_ Chain = (*Backoff)(nil)
+)
+
+// ErrOrder is returned when a chain is asked for an order below one.
+var ErrOrder = errors.New("chain order must be above zero")
+
+// ErrUnknownState is returned when a Conditional is asked for a state it was not trained on.
+var ErrUnknownState = errors.New("unknown state")
+
+// ErrTuple is returned when a state of a Joint chain is not a (frequency, amplitude, duration) tuple.
+var ErrTuple = errors.New("state is not a frequency, amplitude and duration tuple")
+
+// Orders holds the order of each chain of a Model. Zero means the default
+// order, one for Freq, Amp, Dur and Joint and two for Poly.
+type Orders struct {
+	Freq  int
+	Amp   int
+	Dur   int
+	Joint int
+	Poly  int
+}
+
+// Backoff is a variable-order Markov chain. It holds a chain for every order from one
+// up to Order and generates from the longest context it has seen, backing off to
+// shorter ones, so that generations keep a long memory without getting stuck.
+type Backoff struct {
+	// chains holds the chains in ascending order, chains[i] being of order i+1.
+	chains []*gomarkov.Chain
+}
+
+// NewBackoff returns a Backoff of order.
+func NewBackoff(order int) *Backoff {
+	b := &Backoff{}
+	for o := 1; o <= order; o++ {
+		b.chains = append(b.chains, gomarkov.NewChain(o))
+	}
+
+	return b
+}
+
+// Order returns the longest context the chain remembers.
+func (b *Backoff) Order() int {
+	return len(b.chains)
+}
+
+// Add adds the transitions of input to the chains of every order.
+func (b *Backoff) Add(input []string) {
+	for _, chain := range b.chains {
+		chain.Add(input)
+	}
+}
+
+// GenerateDeterministic returns the state following current, an n-gram of length Order,
+// from the chain of the longest context that has seen the end of current.
+func (b *Backoff) GenerateDeterministic(current gomarkov.NGram, prng gomarkov.PRNG) (string, error) {
+	if len(current) != b.Order() {
+		return "", fmt.Errorf("n-gram length %d does not match order %d", len(current), b.Order())
+	}
+
+	var err error
+	for o := b.Order(); o > 0; o-- {
+		var next string
+		// Unknown contexts fail before anything is drawn from prng.
+		next, err = b.chains[o-1].GenerateDeterministic(current[len(current)-o:], prng)
+		if err == nil {
+			return next, nil
+		}
+	}
+
+	return "", err
+}
+
+// MarshalJSON implements json.Marshaler. It writes the chain of the highest order
+// with the lower ones next to it under "backoff", so that a Backoff can also be
+// read as a plain chain of its order.
+func (b *Backoff) MarshalJSON() ([]byte, error) {
+	if b.Order() == 0 {
+		return nil, ErrOrder
+	}
+
+	highest, err := b.chains[b.Order()-1].MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(highest, &fields); err != nil {
+		return nil, err
+	}
+
+	lower, err := json.Marshal(b.chains[:b.Order()-1])
+	if err != nil {
+		return nil, err
+	}
+
+	fields["backoff"] = lower
+
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b *Backoff) UnmarshalJSON(data []byte) error {
+	var highest gomarkov.Chain
+	if err := highest.UnmarshalJSON(data); err != nil {
+		return err
+	}
+
+	var lower struct {
+		Backoff []*gomarkov.Chain `json:"backoff"`
+	}
+
+	if err := json.Unmarshal(data, &lower); err != nil {
+		return err
+	}
+
+	b.chains = append(lower.Backoff, &highest)
+
+	return nil
+}
+
+// loadChain reads a chain exported by Model.Export, a Backoff
+// if it was exported as one and a plain chain otherwise.
+func loadChain(data []byte) (Chain, error) {
+	var kind struct {
+		Backoff json.RawMessage `json:"backoff"`
+	}
+
+	if err := json.Unmarshal(data, &kind); err != nil {
+		return nil, err
+	}
+
+	var chain Chain = &gomarkov.Chain{}
+	if kind.Backoff != nil {
+		chain = &Backoff{}
+	}
+
+	if err := chain.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+
+	return chain, nil
+}
+
+// newChain returns a chain of order, or of defaultOrder if order is zero.
+func newChain(order, defaultOrder int, backoff bool) Chain {
+	if order == 0 {
+		order = defaultOrder
+	}
+
+	if backoff {
+		return NewBackoff(order)
+	}
+
+	return gomarkov.NewChain(order)
+}
+
+// Conditional counts the values that were seen along with a state, such as the
+// amplitudes a frequency was played with, and draws new values from them.
+type Conditional struct {
+	Counts map[string]map[string]int `json:"counts"`
+}
+
+// NewConditional returns an empty Conditional.
+func NewConditional() *Conditional {
+	return &Conditional{
+		Counts: make(map[string]map[string]int),
+	}
+}
+
+// Add counts value as seen along with given.
+func (c *Conditional) Add(given, value string) {
+	if c.Counts[given] == nil {
+		c.Counts[given] = make(map[string]int)
+	}
+
+	c.Counts[given][value]++
+}
+
+// Generate draws a value seen along with given, in proportion to how often it was.
+// The same prng state always draws the same value.
+func (c *Conditional) Generate(given string, prng gomarkov.PRNG) (string, error) {
+	counts, ok := c.Counts[given]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownState, given)
+	}
+
+	values := make([]string, 0, len(counts))
+
+	var sum int
+	for v, count := range counts {
+		values = append(values, v)
+		sum += count
+	}
+
+	slices.Sort(values)
+
+	n := prng.Intn(sum)
+	for _, v := range values {
+		n -= counts[v]
+		if n < 0 {
+			return v, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w %q", ErrUnknownState, given)
+}
@@ -0,0 +1,176 @@
+package markov
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mb-14/gomarkov"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bh90210/mlsic"
+)
+
+// noHarmonics renders fundamentals only.
+type noHarmonics struct{}
+
+func (noHarmonics) Partials() []mlsic.Partial {
+	return nil
+}
+
+func TestBackoff(t *testing.T) {
+	a := assert.New(t)
+
+	b := NewBackoff(3)
+	b.Add([]string{"a", "b", "c", "d"})
+	b.Add([]string{"x", "y", "c", "e"})
+	a.Equal(3, b.Order())
+
+	// The full context is known.
+	next, err := b.GenerateDeterministic(gomarkov.NGram{"a", "b", "c"}, rand.New(rand.NewSource(1)))
+	a.NoError(err)
+	a.Equal("d", next)
+
+	// Only the last state is known, a plain chain of the same order gives up.
+	next, err = b.GenerateDeterministic(gomarkov.NGram{"y", "b", "c"}, rand.New(rand.NewSource(1)))
+	a.NoError(err)
+	a.Contains([]string{"d", "e"}, next)
+
+	_, err = b.chains[2].GenerateDeterministic(gomarkov.NGram{"y", "b", "c"}, rand.New(rand.NewSource(1)))
+	a.Error(err)
+
+	_, err = b.GenerateDeterministic(gomarkov.NGram{"z", "z", "z"}, rand.New(rand.NewSource(1)))
+	a.Error(err)
+
+	_, err = b.GenerateDeterministic(gomarkov.NGram{"c"}, rand.New(rand.NewSource(1)))
+	a.Error(err)
+
+	// Backoff chains survive a round trip and can be read as plain chains of their order.
+	data, err := b.MarshalJSON()
+	a.NoError(err)
+
+	loaded, err := loadChain(data)
+	a.NoError(err)
+	a.IsType(&Backoff{}, loaded)
+	a.Equal(3, loaded.(*Backoff).Order())
+
+	next, err = loaded.GenerateDeterministic(gomarkov.NGram{"y", "b", "c"}, rand.New(rand.NewSource(1)))
+	a.NoError(err)
+	a.Contains([]string{"d", "e"}, next)
+
+	var plain gomarkov.Chain
+	a.NoError(plain.UnmarshalJSON(data))
+	a.Equal(3, plain.Order)
+
+	_, err = (&Backoff{}).MarshalJSON()
+	a.ErrorIs(err, ErrOrder)
+}
+
+func TestModelOrders(t *testing.T) {
+	a := assert.New(t)
+
+	var train []Sine
+	for i := 0; i < 12; i++ {
+		train = append(train, Sine{
+			Frequency: 220. * float64(1+i%4),
+			Amplitude: .1 * float64(1+i%3),
+			Duration:  time.Duration(20+10*(i%2)) * time.Millisecond,
+		})
+	}
+
+	m := Model{Orders: Orders{Freq: 3, Dur: 2}}
+	m.Add(train)
+
+	seed := t.TempDir()
+	a.NoError(m.Export(seed))
+
+	orders := func(path string) []int {
+		var got []int
+		for _, name := range []string{"freq.json", "amp.json", "dur.json"} {
+			data, err := os.ReadFile(filepath.Join(path, name))
+			a.NoError(err)
+
+			chain, err := loadChain(data)
+			a.NoError(err)
+			got = append(got, chain.(*gomarkov.Chain).Order)
+		}
+
+		return got
+	}
+
+	a.Equal([]int{3, 1, 2}, orders(seed))
+
+	// The generations are trained on chains of the orders of the seed.
+	s := Song{
+		NGenerations:  2,
+		FilePath:      t.TempDir(),
+		ModelsPath:    t.TempDir(),
+		SeedModelPath: seed,
+		Harmonics:     noHarmonics{},
+	}
+
+	a.NoError(s.NGen())
+
+	// Higher order chains still generate music.
+	info, err := os.Stat(filepath.Join(s.FilePath, "ngen00.wav"))
+	a.NoError(err)
+	a.Greater(info.Size(), int64(mlsic.SampleRate/10))
+
+	a.Equal([]int{3, 1, 2}, orders(filepath.Join(s.ModelsPath, "gen0")))
+	a.Equal([]int{3, 1, 2}, orders(filepath.Join(s.ModelsPath, "gen1")))
+}
+
+func TestModelBackoff(t *testing.T) {
+	a := assert.New(t)
+
+	m := Model{Orders: Orders{Freq: 2}, Backoff: true}
+	m.Add([]Sine{{Frequency: 440., Amplitude: .1, Duration: 20 * time.Millisecond}, {Frequency: 660., Amplitude: .1, Duration: 20 * time.Millisecond}})
+
+	a.Equal(2, m.Freq.(*Backoff).Order())
+	a.Equal(1, m.Amp.(*Backoff).Order())
+
+	path := t.TempDir()
+	a.NoError(m.Export(path))
+
+	data, err := os.ReadFile(filepath.Join(path, "freq.json"))
+	a.NoError(err)
+
+	chain, err := loadChain(data)
+	a.NoError(err)
+	a.Equal(2, chain.(*Backoff).Order())
+}
+
+func TestConditional(t *testing.T) {
+	a := assert.New(t)
+
+	c := NewConditional()
+	c.Add("440", "0.1")
+	c.Add("440", "0.1")
+	c.Add("440", "0.3")
+	c.Add("220", "0.2")
+
+	next, err := c.Generate("220", rand.New(rand.NewSource(1)))
+	a.NoError(err)
+	a.Equal("0.2", next)
+
+	drawn := make(map[string]int)
+	prng := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		next, err := c.Generate("440", prng)
+		a.NoError(err)
+		drawn[next]++
+	}
+
+	a.Len(drawn, 2)
+	a.Greater(drawn["0.1"], drawn["0.3"])
+
+	// The same prng state draws the same value.
+	first, _ := c.Generate("440", rand.New(rand.NewSource(7)))
+	second, _ := c.Generate("440", rand.New(rand.NewSource(7)))
+	a.Equal(first, second)
+
+	_, err = c.Generate("880", prng)
+	a.ErrorIs(err, ErrUnknownState)
+}
@@ -1,11 +1,14 @@
 package markov
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -14,20 +17,54 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/bh90210/mlsic"
+	"github.com/bh90210/mlsic/master"
+	"github.com/bh90210/mlsic/oscillator"
 	"github.com/bh90210/mlsic/render"
 	"github.com/go-audio/generator"
-	"github.com/mb-14/gomarkov"
 )
 
 // Model .
 type Model struct {
-	Freq *gomarkov.Chain
-	Amp  *gomarkov.Chain
-	Dur  *gomarkov.Chain
-
-	Poly *gomarkov.Chain
+	Freq Chain
+	Amp  Chain
+	Dur  Chain
+
+	// Joint is the chain of (frequency, amplitude, duration) tuples of the Joint mode.
+	Joint Chain
+	// AmpGivenFreq and DurGivenFreq are the amplitudes and durations
+	// each frequency was played with, of the Factored mode.
+	AmpGivenFreq *Conditional
+	DurGivenFreq *Conditional
+
+	Poly Chain
+
+	// Mode selects the fields Add trains.
+	Mode Mode
+
+	// Orders are the orders of the chains Model creates for the fields left nil.
+	// The order of a chain is exported along with it and kept when it is loaded.
+	Orders Orders
+	// Backoff makes the chains Model creates variable-order Backoff chains.
+	Backoff bool
+	// Quantizers snap the values to grids before they become states.
+	Quantizers Quantizers
 }
 
+// Mode is how a Model relates the frequency, amplitude and duration of the sines.
+type Mode int
+
+const (
+	// Independent trains a chain for each of frequency, amplitude and
+	// duration. Their generations are zipped together.
+	Independent Mode = iota
+	// Joint trains a single chain on (frequency, amplitude, duration) tuples,
+	// keeping the correlation between pitch, loudness and length.
+	Joint
+	// Factored trains a chain on frequencies and draws the amplitude and
+	// the duration of every generated frequency given that frequency.
+	Factored
+)
+
 // Add .
 func (m *Model) Add(train []Sine) {
 	m.nilCheck()
@@ -37,90 +74,102 @@ func (m *Model) Add(train []Sine) {
 	duration := []string{}
 
 	for _, v := range train {
+		v = m.Quantizers.sine(v)
+
 		frequency = append(frequency, fmt.Sprintf("%f", v.Frequency))
 		amplitude = append(amplitude, fmt.Sprintf("%f", v.Amplitude))
 		duration = append(duration, fmt.Sprintf("%v", v.Duration.Milliseconds()))
 	}
 
-	m.Freq.Add(frequency)
-	m.Amp.Add(amplitude)
-	m.Dur.Add(duration)
-}
-
-type indexHelper struct {
-	voice        int
-	voiceIndex   int
-	toneIndex    int
-	partialIndex int
-}
-
-// AddPoly .
-func (m *Model) AddPoly(poly []Voice) {
-	m.nilCheck(true)
+	switch m.Mode {
+	case Joint:
+		tuples := make([]string, len(train))
+		for i := range train {
+			tuples[i] = strings.Join([]string{frequency[i], amplitude[i], duration[i]}, " ")
+		}
 
-	// We will collect all indices there is a sine in a map[int].
-	// the slice if ints []int are the voices this particular index
-	// has a corresponding sine. This is because multiple voices may
-	// share the same index.
-	// For example: map[trainIndex+wagonIndex][voice][wagonIndex].
-	indices := make(map[int][]indexHelper)
-	for voiceNo, voice := range poly {
-		for toneIndex, tone := range voice {
-			indices[toneIndex] = append(indices[toneIndex], indexHelper{
-				voice:        voiceNo,
-				voiceIndex:   toneIndex,
-				toneIndex:    toneIndex,
-				partialIndex: -1,
-			})
+		m.Joint.Add(tuples)
 
-			for partialIndex, partial := range tone.Partials {
-				indices[toneIndex+partial.StartInSamples()] = append(indices[toneIndex+partial.StartInSamples()], indexHelper{
-					voice:        voiceNo,
-					voiceIndex:   toneIndex,
-					toneIndex:    toneIndex,
-					partialIndex: partialIndex,
-				})
-			}
+	case Factored:
+		m.Freq.Add(frequency)
+		for i := range train {
+			m.AmpGivenFreq.Add(frequency[i], amplitude[i])
+			m.DurGivenFreq.Add(frequency[i], duration[i])
 		}
-	}
 
-	// Order indices.
-	OrderedIndices := make([]int, 0)
-	for k := range indices {
-		OrderedIndices = append(OrderedIndices, k)
+	default:
+		m.Freq.Add(frequency)
+		m.Amp.Add(amplitude)
+		m.Dur.Add(duration)
 	}
+}
 
-	sort.Ints(OrderedIndices)
+// AddPoly adds poly to the Poly chain as a single sequence of PolyEvent states.
+func (m *Model) AddPoly(poly []Voice, sampleRate int) {
+	m.nilCheck(true)
 
-	for _, i := range OrderedIndices {
-		indexHelpers := indices[i]
-		for _, h := range indexHelpers {
-			tone := poly[h.voice][h.voiceIndex]
-			t := []string{}
+	events := m.polyEvents(poly, sampleRate)
 
-			// This means we are dealing with fundamental.
-			switch h.partialIndex {
-			case -1:
-				if h.partialIndex == -1 {
-					t = append(t, fmt.Sprintf("%f", tone.Fundamental.Frequency))
-					t = append(t, fmt.Sprintf("%f", tone.Fundamental.Amplitude))
-					t = append(t, fmt.Sprintf("%v", tone.Fundamental.DurationInSamples()))
-					t = append(t, fmt.Sprintf("%f", tone.Panning))
-					m.Poly.Add([]string{strings.Join(t, " ")})
-				}
+	states := make([]string, len(events))
+	for i, e := range events {
+		states[i] = e.String()
+	}
 
-			default:
-				partial := tone.Partials[h.partialIndex]
+	m.Poly.Add(states)
+}
 
-				t = append(t, fmt.Sprintf("%f", tone.Fundamental.Frequency*float64(partial.Number)))
-				t = append(t, fmt.Sprintf("%f", tone.Fundamental.Amplitude*partial.AmplitudeFactor))
-				t = append(t, fmt.Sprintf("%v", partial.DurationInSamples()))
-				t = append(t, fmt.Sprintf("%f", tone.Panning))
-			}
+// polyEvents returns the events of poly in the order they are added to the Poly chain.
+// The tones of all voices are ordered by their index and then by their voice, each
+// followed by its partials.
+func (m *Model) polyEvents(poly []Voice, sampleRate int) []PolyEvent {
+	type start struct {
+		voice int
+		index int
+	}
 
-			m.Poly.Add([]string{strings.Join(t, " ")})
+	var starts []start
+	for voice, v := range poly {
+		for _, index := range v.Ordered() {
+			starts = append(starts, start{voice: voice, index: index})
+		}
+	}
+
+	// Voices are walked in order, so tones starting together keep the order of their voices.
+	sort.SliceStable(starts, func(i, j int) bool {
+		return starts[i].index < starts[j].index
+	})
+
+	var events []PolyEvent
+	var previous int
+	for _, s := range starts {
+		tone := poly[s.voice][s.index]
+		panning := m.Quantizers.panning(tone.Panning)
+
+		events = append(events, PolyEvent{
+			Onset:     s.index - previous,
+			Voice:     s.voice,
+			Frequency: m.Quantizers.frequency(tone.Fundamental.Frequency),
+			Amplitude: m.Quantizers.amplitude(tone.Fundamental.Amplitude),
+			Duration:  mlsic.DurationInSamples(m.Quantizers.duration(tone.Fundamental.Duration), sampleRate),
+			Panning:   panning,
+		})
+
+		previous = s.index
+
+		for _, partial := range tone.Partials {
+			events = append(events, PolyEvent{
+				Onset:     partial.StartInSamples(sampleRate),
+				Voice:     s.voice,
+				Partial:   partial.Number,
+				Frequency: m.Quantizers.frequency(tone.Fundamental.Frequency * float64(partial.Number)),
+				Amplitude: m.Quantizers.amplitude(tone.Fundamental.Amplitude * partial.AmplitudeFactor),
+				Duration:  mlsic.DurationInSamples(m.Quantizers.duration(partial.Duration), sampleRate),
+				Panning:   panning,
+			})
 		}
 	}
+
+	return events
 }
 
 // Export .
@@ -174,33 +223,142 @@ func (m *Model) Export(path string) error {
 			return err
 		}
 	}
+
+	if m.Joint != nil {
+		joint, err := m.Joint.MarshalJSON()
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(path, "joint.json"), joint, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.AmpGivenFreq != nil {
+		amp, err := json.Marshal(m.AmpGivenFreq)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(path, "amp_freq.json"), amp, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.DurGivenFreq != nil {
+		dur, err := json.Marshal(m.DurGivenFreq)
+		if err != nil {
+			return err
+		}
+
+		err = os.WriteFile(filepath.Join(path, "dur_freq.json"), dur, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (m *Model) nilCheck(poly ...bool) {
 	if poly != nil {
 		if m.Poly == nil {
-			m.Poly = gomarkov.NewChain(2)
+			m.Poly = newChain(m.Orders.Poly, 2, m.Backoff)
+		}
+
+		return
+	}
+
+	switch m.Mode {
+	case Joint:
+		if m.Joint == nil {
+			m.Joint = newChain(m.Orders.Joint, 1, m.Backoff)
 		}
 
 		return
+
+	case Factored:
+		if m.AmpGivenFreq == nil {
+			m.AmpGivenFreq = NewConditional()
+		}
+
+		if m.DurGivenFreq == nil {
+			m.DurGivenFreq = NewConditional()
+		}
 	}
 
 	if m.Freq == nil {
-		m.Freq = gomarkov.NewChain(1)
+		m.Freq = newChain(m.Orders.Freq, 1, m.Backoff)
+	}
+
+	if m.Mode == Factored {
+		return
 	}
 
 	if m.Amp == nil {
-		m.Amp = gomarkov.NewChain(1)
+		m.Amp = newChain(m.Orders.Amp, 1, m.Backoff)
 	}
 
 	if m.Dur == nil {
-		m.Dur = gomarkov.NewChain(1)
+		m.Dur = newChain(m.Orders.Dur, 1, m.Backoff)
+	}
+}
+
+// GenerateOption is a custom type function that accepts *generate
+// and is used by the WithXXX Generate options functions.
+type GenerateOption func(*generate)
+
+type generate struct {
+	bandLimit mlsic.BandLimit
+	mastering []master.Option
+}
+
+// WithTrainBandLimit band-limits the partials and waveforms of the train.
+// If not set mlsic.NewBandLimit of the sample rate is used.
+func WithTrainBandLimit(limit mlsic.BandLimit) GenerateOption {
+	return func(g *generate) {
+		g.bandLimit = limit
+	}
+}
+
+// WithMastering sets the options of the mastering stage the train is rendered
+// through, in place of limiting its peaks to -1 dBFS. Without options the
+// train is rendered as it is.
+func WithMastering(opts ...master.Option) GenerateOption {
+	return func(g *generate) {
+		g.mastering = opts
 	}
 }
 
-// Generate .
-func Generate(filepath string, train []Sine, h mlsic.Harmonics, ngen int) {
+// defaultMastering limits the peaks to -1 dBFS instead of letting them clip.
+func defaultMastering() []master.Option {
+	return []master.Option{master.WithLimiter(-1)}
+}
+
+// Generate renders train, with the partials of h, as a mono .wav file named ngen{ngen}.wav in filepath
+// and returns the report of its mastering. Peaks are limited to -1 dBFS unless WithMastering is given.
+func Generate(filepath string, train []Sine, h mlsic.Harmonics, ngen, sampleRate int, opts ...GenerateOption) (master.Report, error) {
+	g := generate{
+		bandLimit: mlsic.NewBandLimit(sampleRate),
+		mastering: defaultMastering(),
+	}
+
+	for _, opt := range opts {
+		opt(&g)
+	}
+
+	limit := g.bandLimit
+	if limit == (mlsic.BandLimit{}) {
+		limit = mlsic.NewBandLimit(sampleRate)
+	}
+
+	if !validBandLimit(limit, sampleRate) {
+		return master.Report{}, ErrBandLimit
+	}
+
 	// Left channel.
 	leftM := make(map[int][]float64, len(train))
 	// Right channel.
@@ -213,44 +371,64 @@ func Generate(filepath string, train []Sine, h mlsic.Harmonics, ngen int) {
 
 	partials := h.Partials()
 
+	// Tones are as long as the samples between the absolute times they start at,
+	// so that the train keeps to wall-clock time however long it is.
+	starts := make([]int, len(train)+1)
+	var elapsed time.Duration
+	for i, v := range train {
+		elapsed += v.Duration.Abs()
+		starts[i+1] = mlsic.DurationInSamples(elapsed, sampleRate)
+	}
+
 	for i, v := range train {
 		wg.Add(1)
 
 		go func(i int, v Sine) {
 			defer wg.Done()
 
-			osc := generator.NewOsc(generator.WaveSine, v.Frequency, 44100)
-			osc.Amplitude = v.Amplitude
+			length := starts[i+1] - starts[i]
+
+			var signal []float64
+			if v.Waveform == nil {
+				osc := generator.NewOsc(generator.WaveSine, v.Frequency, sampleRate)
+				osc.Amplitude = v.Amplitude
+
+				signal = osc.Signal(length)
+			} else {
+				frequency := func(int) float64 { return v.Frequency }
+				_, _, signal = sweep(v.Waveform, frequency, 1, 0, 0, length, limit, sampleRate)
+				for o := range signal {
+					signal[o] *= v.Amplitude
+				}
+			}
 
-			signal := osc.Signal(44 * int(v.Duration.Abs().Milliseconds()))
+			if v.Envelope != nil {
+				mlsic.ApplyEnvelope(signal, v.Envelope, v.Duration, sampleRate)
+			}
 
 			for _, p := range partials {
-				if v.Frequency*float64(p.Number) > 18000 {
+				gain := limit.Gain(v.Frequency * float64(p.Number))
+				if gain == 0 {
 					continue
 				}
 
-				osc = generator.NewOsc(generator.WaveSine, v.Frequency*float64(p.Number), 44100)
+				osc := generator.NewOsc(generator.WaveSine, v.Frequency*float64(p.Number), sampleRate)
 
 				if p.AmplitudeFactor < 0 {
 					p.AmplitudeFactor *= -1
 				}
 
-				osc.Amplitude = v.Amplitude * p.AmplitudeFactor
+				osc.Amplitude = v.Amplitude * p.AmplitudeFactor * gain
 
-				partialSignal := osc.Signal(44 * int(v.Duration.Abs().Milliseconds()))
+				partialSignal := osc.Signal(length)
+				if p.Envelope != nil {
+					mlsic.ApplyEnvelope(partialSignal, p.Envelope, v.Duration, sampleRate)
+				}
 				for i := range signal {
 					signal[i] += partialSignal[i]
 				}
 			}
 
-			for o, s := range signal {
-				if s >= 1. {
-					signal[o] = 0.
-				} else if s <= -1. {
-					signal[o] = 0.
-				}
-			}
-
 			mu.Lock()
 			leftM[i] = signal
 			rightM[i] = signal
@@ -275,10 +453,10 @@ func Generate(filepath string, train []Sine, h mlsic.Harmonics, ngen int) {
 
 	log.Info().Msg("rendering audio files")
 
-	// Render.
-	p := render.Wav{
-		Filepath: filepath,
-	}
+	p := master.New(&render.Wav{
+		Filepath:   filepath,
+		SampleRate: sampleRate,
+	}, append([]master.Option{master.WithSampleRate(sampleRate)}, g.mastering...)...)
 
 	// p, err := render.NewPortAudio()
 	// if err != nil {
@@ -286,8 +464,10 @@ func Generate(filepath string, train []Sine, h mlsic.Harmonics, ngen int) {
 	// }
 
 	if err := p.Render(music, fmt.Sprintf("ngen%v", ngen)); err != nil {
-		log.Fatal().Err(err)
+		return master.Report{}, fmt.Errorf("rendering: %w", err)
 	}
+
+	return p.Report(), nil
 }
 
 // MaximumPartialStartingPoint .
@@ -299,81 +479,393 @@ const MinimumPartialDuration = 10
 // ErrNotEnoughSpeakers .
 var ErrNotEnoughSpeakers = errors.New("allowed number of speakers is 1+")
 
-// Deconstruct .
-func Deconstruct(poly []Voice, noOfSpeakers int) ([]mlsic.Audio, error) {
+// ErrSampleRate is returned when the sample rate is not a positive number.
+var ErrSampleRate = errors.New("sample rate must be above zero")
+
+// ErrBandLimit is returned when the ceiling of a band limit is not
+// between zero and the Nyquist frequency, or its roll-off is negative.
+var ErrBandLimit = errors.New("band limit ceiling must be above zero and up to the Nyquist frequency")
+
+// ErrWorkers is returned when Deconstruct is asked to render on less than one worker.
+var ErrWorkers = errors.New("number of workers must be above zero")
+
+// DeconstructOption is a custom type function that accepts *deconstruct
+// and is used by the WithXXX Deconstruct options functions.
+type DeconstructOption func(*deconstruct)
+
+// deconstruct holds the settings Deconstruct operates with.
+type deconstruct struct {
+	sampleRate int
+	panLaw     mlsic.PanLaw
+	vbap       bool
+	oscillator oscillator.Oscillator
+	workers    int
+	bandLimit  mlsic.BandLimit
+}
+
+// WithSampleRate sets the sample rate Deconstruct renders at.
+// If not set mlsic.SampleRate is used.
+func WithSampleRate(sampleRate int) DeconstructOption {
+	return func(d *deconstruct) {
+		d.sampleRate = sampleRate
+	}
+}
+
+// WithPanLaw sets the pan law tones are panned to the speakers with,
+// overriding the PanLaw and the VBAP of the layout.
+func WithPanLaw(panLaw mlsic.PanLaw) DeconstructOption {
+	return func(d *deconstruct) {
+		d.panLaw = panLaw
+		d.vbap = false
+	}
+}
+
+// WithVBAP pans tones to the speakers with vector base amplitude panning,
+// as if VBAP was set on the layout, overriding its PanLaw.
+func WithVBAP() DeconstructOption {
+	return func(d *deconstruct) {
+		d.panLaw = nil
+		d.vbap = true
+	}
+}
+
+// WithOscillator sets the oscillator steady sine waves are rendered with.
+// If not set every sample is computed with math.Sin. Glides and
+// waveforms other than sine are always computed sample by sample.
+func WithOscillator(o oscillator.Oscillator) DeconstructOption {
+	return func(d *deconstruct) {
+		d.oscillator = o
+	}
+}
+
+// WithBandLimit sets the band limit partials are rendered with. If not
+// set mlsic.NewBandLimit of the sample rate is used.
+func WithBandLimit(limit mlsic.BandLimit) DeconstructOption {
+	return func(d *deconstruct) {
+		d.bandLimit = limit
+	}
+}
+
+// validBandLimit reports whether limit has its ceiling up to the Nyquist frequency of sampleRate.
+func validBandLimit(limit mlsic.BandLimit, sampleRate int) bool {
+	return limit.Ceiling > 0 && limit.Ceiling <= mlsic.Nyquist(sampleRate) && limit.RollOff >= 0
+}
+
+// WithWorkers sets the number of goroutines tones are rendered on.
+// If not set runtime.GOMAXPROCS(0) is used. The output does
+// not depend on the number of workers.
+func WithWorkers(workers int) DeconstructOption {
+	return func(d *deconstruct) {
+		d.workers = workers
+	}
+}
+
+// Deconstruct renders poly to one channel of audio for each speaker of layout.
+// It reads a DeconstructReader to the end, keeping the whole piece in memory.
+func Deconstruct(poly []Voice, layout mlsic.Layout, opts ...DeconstructOption) ([]mlsic.Audio, error) {
+	r, err := NewDeconstructReader(poly, layout, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return mlsic.ReadAll(r, layout.Len())
+}
+
+var _ mlsic.Reader = (*DeconstructReader)(nil)
+
+// DeconstructReader implements mlsic.Reader rendering poly one chunk at a time.
+// Only the tones sounding within the chunk being read are kept in memory,
+// so arbitrarily long pieces can be streamed in constant memory.
+type DeconstructReader struct {
+	voices       []voiceReader
+	layout       mlsic.Layout
+	noOfSpeakers int
+	sampleRate   int
+	oscillator   oscillator.Oscillator
+	workers      int
+	bandLimit    mlsic.BandLimit
+	length       int
+	pos          int
+
+	// buf holds the signal of a single voice for the chunk being read.
+	buf [][]float64
+}
+
+// voiceReader keeps track of a voice's tones while it is being read.
+type voiceReader struct {
+	voice Voice
+	index []int
+	// next is the position in index of the next tone to be rendered.
+	next int
+	// phase is the last phase of the previously rendered fundamental.
+	phase float64
+	// sounding holds the rendered tones that have not ended yet, in index order.
+	sounding []toneSignal
+}
+
+// toneSignal is the rendered signal of a tone, one slice per speaker.
+type toneSignal struct {
+	start  int
+	signal [][]float64
+}
+
+// NewDeconstructReader returns a Reader streaming poly interleaved, one channel for each speaker of layout.
+func NewDeconstructReader(poly []Voice, layout mlsic.Layout, opts ...DeconstructOption) (*DeconstructReader, error) {
+	noOfSpeakers := layout.Len()
 	if noOfSpeakers < 1 {
 		return nil, ErrNotEnoughSpeakers
 	}
 
-	speakers := make([]mlsic.Audio, noOfSpeakers)
+	d := deconstruct{
+		sampleRate: mlsic.SampleRate,
+		workers:    runtime.GOMAXPROCS(0),
+	}
+
+	for _, opt := range opts {
+		opt(&d)
+	}
+
+	if d.sampleRate < 1 {
+		return nil, ErrSampleRate
+	}
+
+	if d.workers < 1 {
+		return nil, ErrWorkers
+	}
+
+	if d.bandLimit == (mlsic.BandLimit{}) {
+		d.bandLimit = mlsic.NewBandLimit(d.sampleRate)
+	}
+
+	if !validBandLimit(d.bandLimit, d.sampleRate) {
+		return nil, ErrBandLimit
+	}
+
+	switch {
+	case d.vbap:
+		layout.VBAP = true
+
+	case d.panLaw != nil:
+		layout.PanLaw = d.panLaw
+		layout.VBAP = false
+	}
+
+	r := &DeconstructReader{
+		layout:       layout,
+		noOfSpeakers: noOfSpeakers,
+		sampleRate:   d.sampleRate,
+		oscillator:   d.oscillator,
+		workers:      d.workers,
+		bandLimit:    d.bandLimit,
+		buf:          make([][]float64, noOfSpeakers),
+	}
 
 	for _, voice := range poly {
-		voiceIndex := voice.Ordered()
-		voiceSignals := voice.Signals(noOfSpeakers)
-
-		// We need to set the last phase of a sine
-		// as the starting position of the next one.
-		var previousFundamentalPhase float64
-		// Range through the voice's tones.
-		for _, i := range voiceIndex {
-			// Set the tone to work this for this loop.
-			tone := voice[i]
-			// Generate fundamental's signal.
-			phase, length, signal := tone.Signal(previousFundamentalPhase)
-
-			// Set starting phase for next sine in voice.
-			previousFundamentalPhase = phase
-
-			// Create temporary slices for tone,
-			toneSignal := make([][]float64, noOfSpeakers)
-			// We the appropriate length for the duration of the fundamental.
-			for o := range toneSignal {
-				toneSignal[o] = make([]float64, length)
-			}
+		r.voices = append(r.voices, voiceReader{
+			voice: voice,
+			index: voice.Ordered(),
+		})
 
-			// Append fundamental's signal to the temporary buffer.
-			for o, v := range signal {
-				for speakerNumber := 0; speakerNumber < noOfSpeakers; speakerNumber++ {
-					// Panning.
-					panning := mlsic.Panning(noOfSpeakers, speakerNumber, tone.Panning)
+		if length := voice.signalsLength(d.sampleRate); length > r.length {
+			r.length = length
+		}
+	}
 
-					toneSignal[speakerNumber][o] += v * tone.Fundamental.Amplitude * panning
-				}
+	return r, nil
+}
+
+// Channels returns the number of channels of the stream.
+func (r *DeconstructReader) Channels() int {
+	return r.noOfSpeakers
+}
+
+// Length returns the length of the stream in frames.
+func (r *DeconstructReader) Length() int {
+	return r.length
+}
+
+// Read implements mlsic.Reader.
+func (r *DeconstructReader) Read(p mlsic.Audio) (int, error) {
+	if r.pos >= r.length {
+		return 0, io.EOF
+	}
+
+	frames := min(len(p)/r.noOfSpeakers, r.length-r.pos)
+	if frames == 0 {
+		return 0, io.ErrShortBuffer
+	}
+
+	if len(r.buf[0]) < frames {
+		for speakerNo := range r.buf {
+			r.buf[speakerNo] = make([]float64, frames)
+		}
+	}
+
+	end := r.pos + frames
+
+	out := p[:frames*r.noOfSpeakers]
+	clear(out)
+
+	// Collect the tones starting within this chunk.
+	tones := make([][]*toneRender, len(r.voices))
+	for v := range r.voices {
+		voice := &r.voices[v]
+
+		for voice.next < len(voice.index) && voice.index[voice.next] < end {
+			i := voice.index[voice.next]
+			tone := voice.voice[i]
+
+			// Tones glide into the frequency of the tone that follows them.
+			var next float64
+			if voice.next+1 < len(voice.index) {
+				next = voice.voice[voice.index[voice.next+1]].Fundamental.Frequency
 			}
 
-			for _, partial := range tone.Partials {
-				_, _, partialSignal := tone.PartialSignal(partial)
-				for o, v := range partialSignal {
-					for speakerNumber := 0; speakerNumber < noOfSpeakers; speakerNumber++ {
-						// Panning.
-						panning := mlsic.Panning(noOfSpeakers, speakerNumber, tone.Panning)
+			tones[v] = append(tones[v], &toneRender{
+				tone:     tone,
+				start:    i,
+				glide:    tone.glide(next, r.sampleRate),
+				partials: make([]mlsic.Audio, len(tone.Partials)),
+			})
 
-						toneSignal[speakerNumber][o+partial.StartInSamples()] += v * (tone.Fundamental.Amplitude * partial.AmplitudeFactor) * panning
-					}
-				}
+			voice.next++
+		}
+	}
+
+	r.render(tones)
+
+	for v := range r.voices {
+		voice := &r.voices[v]
+
+		for _, tone := range tones[v] {
+			voice.sounding = append(voice.sounding, toneSignal{
+				start:  tone.start,
+				signal: tone.signal,
+			})
+		}
+
+		for _, buf := range r.buf {
+			clear(buf[:frames])
+		}
+
+		// Within a voice a tone overwrites any previous one it overlaps.
+		var sounding []toneSignal
+		for _, tone := range voice.sounding {
+			toneEnd := tone.start + len(tone.signal[0])
+
+			from := max(tone.start, r.pos)
+			to := min(toneEnd, end)
+			for speakerNo, signal := range tone.signal {
+				copy(r.buf[speakerNo][from-r.pos:to-r.pos], signal[from-tone.start:to-tone.start])
 			}
 
-			for speakerNo, signal := range toneSignal {
-				for o, v := range signal {
-					voiceSignals[speakerNo][i+o] = v
-				}
+			if toneEnd > end {
+				sounding = append(sounding, tone)
 			}
 		}
 
-		for speakerNo, signal := range voiceSignals {
-			if len(speakers[speakerNo]) < len(signal) {
-				speakers[speakerNo] = append(speakers[speakerNo], make([]float64, len(signal)-len(speakers[speakerNo]))...)
+		voice.sounding = sounding
+
+		// Mix the voice to the rest.
+		for speakerNo, buf := range r.buf {
+			for i := 0; i < frames; i++ {
+				out[i*r.noOfSpeakers+speakerNo] += buf[i]
 			}
 		}
+	}
+
+	r.pos = end
+
+	return frames * r.noOfSpeakers, nil
+}
+
+// toneRender is a tone being rendered by the workers of a DeconstructReader.
+type toneRender struct {
+	tone  Tone
+	start int
+	glide func(sample int) float64
+
+	fundamental mlsic.Audio
+	partials    []mlsic.Audio
+	signal      [][]float64
+}
+
+// render renders tones, the tones of every voice starting within a chunk, on at most
+// r.workers goroutines. The fundamentals of a voice are rendered in order, as each
+// starts at the phase the previous one ended, while partials do not depend on
+// anything and are rendered one by one. Once all are done the tones are panned.
+// Every sample is computed by the same operations in the same order regardless
+// of scheduling, so the output is identical for any number of workers.
+func (r *DeconstructReader) render(tones [][]*toneRender) {
+	var tasks []func()
+	for v := range tones {
+		if len(tones[v]) == 0 {
+			continue
+		}
 
-		for speakerNo, signal := range voiceSignals {
-			for i, v := range signal {
-				speakers[speakerNo][i] += v
+		voice := &r.voices[v]
+		tasks = append(tasks, func() {
+			for _, t := range tones[v] {
+				tone := t.tone
+				tone.Fundamental.phase = voice.phase
+				// Set starting phase for next sine in voice.
+				voice.phase, _, t.fundamental = tone.fundamentalSignal(t.glide, r.oscillator, r.bandLimit, r.sampleRate)
 			}
+		})
+
+		for _, t := range tones[v] {
+			for p, partial := range t.tone.Partials {
+				tasks = append(tasks, func() {
+					_, _, t.partials[p] = t.tone.partialSignal(partial, t.glide, r.oscillator, r.bandLimit, r.sampleRate)
+				})
+			}
+		}
+	}
+
+	parallel(r.workers, tasks)
+
+	tasks = tasks[:0]
+	for v := range tones {
+		for _, t := range tones[v] {
+			tasks = append(tasks, func() {
+				t.signal = t.tone.pan(r.layout, t.fundamental, t.partials, r.sampleRate)
+			})
+		}
+	}
+
+	parallel(r.workers, tasks)
+}
+
+// parallel runs tasks on at most workers goroutines and waits for all of them to return.
+func parallel(workers int, tasks []func()) {
+	if workers < 2 || len(tasks) < 2 {
+		for _, task := range tasks {
+			task()
 		}
+
+		return
+	}
+
+	queue := make(chan func())
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(tasks)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for task := range queue {
+				task()
+			}
+		}()
+	}
+
+	for _, task := range tasks {
+		queue <- task
 	}
 
-	return speakers, nil
+	close(queue)
+	wg.Wait()
 }
 
 // Voice is a single monophony from start to finish.
@@ -388,68 +880,290 @@ func (v Voice) Ordered() (voiceIndex []int) {
 }
 
 // Signals .
-func (v Voice) Signals(noOfSpeakers int) (signals [][]float64) {
-	// Determine the total trains length.
-	var length int
-	for k := range v {
-		if length < k {
-			length = k
-		}
-	}
-
-	// Add the duration of voice's last tone.
-	length += v[length].Fundamental.DurationInSamples()
+func (v Voice) Signals(noOfSpeakers, sampleRate int) (signals [][]float64) {
+	length := v.signalsLength(sampleRate)
 
 	// Create signals slices of the appropriate length for each speaker.
 	signals = make([][]float64, noOfSpeakers)
 	for i := range signals {
-		signals[i] = make([]float64, length+44100) // Add one extra second of silence at the end.
+		signals[i] = make([]float64, length)
 	}
 
 	return
 }
 
-// LengthInSamples .
-func (v Voice) LengthInSamples() (length int) {
-	for k, v := range v {
-		if k+v.Fundamental.DurationInSamples() > length {
-			length = k + v.Fundamental.DurationInSamples()
+// signalsLength returns the length in samples of the voice's signals.
+func (v Voice) signalsLength(sampleRate int) int {
+	length := v.LengthInSamples(sampleRate)
+
+	// Partials, of any tone, may sound past the end of the last tone.
+	for k, tone := range v {
+		start := mlsic.SamplesInDuration(k, sampleRate)
+		for _, partial := range tone.Partials {
+			length = max(length, mlsic.DurationInSamples(start+partial.Start+partial.Duration, sampleRate))
 		}
 	}
 
+	// Add one extra second of silence at the end.
+	return length + mlsic.DurationInSamples(time.Second, sampleRate)
+}
+
+// Place adds tone to the voice at the absolute time start and returns the time it ends,
+// where a tone following it starts. The start is converted to samples once, so tones
+// placed one after the other stay on wall-clock time instead of drifting.
+func (v Voice) Place(start time.Duration, tone Tone, sampleRate int) time.Duration {
+	v[mlsic.DurationInSamples(start, sampleRate)] = tone
+
+	return start + tone.Fundamental.Duration
+}
+
+// End returns the time the last fundamental of the voice ends.
+func (v Voice) End(sampleRate int) (end time.Duration) {
+	for k, t := range v {
+		end = max(end, mlsic.SamplesInDuration(k, sampleRate)+t.Fundamental.Duration)
+	}
+
 	return
 }
 
+// LengthInSamples returns the sample the last fundamental of the voice ends at.
+func (v Voice) LengthInSamples(sampleRate int) int {
+	return mlsic.DurationInSamples(v.End(sampleRate), sampleRate)
+}
+
 // Tone .
 type Tone struct { // map[int]Partial
 	Fundamental Sine
 	Partials    []mlsic.Partial
 	// Panning information.
 	Panning float64
+	// PanningCurve, if set, moves the tone through space in place of Panning.
+	// It is evaluated for every sample from the start of the tone.
+	PanningCurve mlsic.Curve
+	// Glide sweeps the tone into the frequency of the next tone of its voice.
+	Glide Glide
+}
+
+// Glide sweeps the frequency of a tone, and of its partials along with it,
+// into the frequency of the next tone of the same voice. The phase stays
+// continuous throughout the sweep and into the next tone.
+type Glide struct {
+	// Duration of the sweep at the end of the tone. Zero disables the glide
+	// and it is capped to the duration of the tone.
+	Duration time.Duration
+	// Curvature shapes the sweep in pitch, as in mlsic.Breakpoint. Zero sweeps
+	// evenly in pitch, positive values start slow and negative values start fast.
+	Curvature float64
 }
 
 // Signal creates a float64 audio signal out of the Sine and returns the length in samples.
 // Note: signal always returns a signal to zero, or a full sine cycle.
 // Inevitably it will return a sightly shorter signal than the original duration
 // intended. This must be dealt with by the consumer.
-func (t Tone) Signal(phase ...float64) (float64, int, mlsic.Audio) {
+func (t Tone) Signal(sampleRate int, phase ...float64) (float64, int, mlsic.Audio) {
+	if phase != nil {
+		t.Fundamental.phase = phase[0]
+	}
+
+	return t.fundamentalSignal(nil, nil, mlsic.NewBandLimit(sampleRate), sampleRate)
+}
+
+// GlideSignal is like Signal but sweeps the tone into the next frequency
+// according to its Glide.
+func (t Tone) GlideSignal(next float64, sampleRate int, phase ...float64) (float64, int, mlsic.Audio) {
 	if phase != nil {
 		t.Fundamental.phase = phase[0]
 	}
 
-	return signal(t.Fundamental.Frequency, t.Fundamental.phase, t.Fundamental.DurationInSamples())
+	return t.fundamentalSignal(t.glide(next, sampleRate), nil, mlsic.NewBandLimit(sampleRate), sampleRate)
+}
+
+// fundamentalSignal renders the fundamental with osc, following the frequencies
+// of glide if it is not nil. Band-limited waveforms follow limit.
+func (t Tone) fundamentalSignal(glide func(sample int) float64, osc oscillator.Oscillator, limit mlsic.BandLimit, sampleRate int) (float64, int, mlsic.Audio) {
+	var (
+		last    float64
+		length  int
+		samples mlsic.Audio
+	)
+	switch {
+	case glide == nil && t.Fundamental.Waveform == nil:
+		last, length, samples = oscillate(osc, t.Fundamental.Frequency, t.Fundamental.phase, t.Fundamental.DurationInSamples(sampleRate), sampleRate)
+
+	case glide == nil:
+		frequency := t.Fundamental.Frequency
+		glide = func(int) float64 { return frequency }
+		fallthrough
+
+	default:
+		last, length, samples = sweep(t.Fundamental.Waveform, glide, 1, 0, t.Fundamental.phase, t.Fundamental.DurationInSamples(sampleRate), limit, sampleRate)
+	}
+
+	if t.Fundamental.Envelope != nil {
+		mlsic.ApplyEnvelope(samples, t.Fundamental.Envelope, t.Fundamental.Duration, sampleRate)
+	}
+
+	return last, length, samples
+}
+
+// glide returns the frequency of the fundamental for every sample of the tone
+// as it glides into next, or nil if the tone does not glide.
+func (t Tone) glide(next float64, sampleRate int) func(sample int) float64 {
+	frequency := t.Fundamental.Frequency
+	if t.Glide.Duration <= 0 || next <= 0 || frequency <= 0 || next == frequency {
+		return nil
+	}
+
+	length := t.Fundamental.DurationInSamples(sampleRate)
+	glideLength := min(mlsic.DurationInSamples(t.Glide.Duration, sampleRate), length)
+	start := length - glideLength
+
+	// The sweep reaches next on the first sample after the tone,
+	// where the next tone picks it up.
+	curve := mlsic.Breakpoints{
+		{Value: 0},
+		{Time: mlsic.SamplesInDuration(glideLength, sampleRate), Value: 1, Curvature: t.Glide.Curvature},
+	}
+	ratio := next / frequency
+
+	return func(sample int) float64 {
+		if sample <= start {
+			return frequency
+		}
+
+		return frequency * math.Pow(ratio, curve.At(mlsic.SamplesInDuration(sample-start, sampleRate)))
+	}
+}
+
+// pan pans the rendered fundamental and partials of the tone to the speakers
+// of layout and returns their mix, one slice per speaker.
+func (t Tone) pan(layout mlsic.Layout, fundamental mlsic.Audio, partials []mlsic.Audio, sampleRate int) [][]float64 {
+	noOfSpeakers := layout.Len()
+
+	fundamentalPanner := newPanner(layout, t.Panning, t.PanningCurve, 0, sampleRate)
+
+	// Create slices long enough for the fundamental and every partial,
+	// as partials may start or keep sounding after the fundamental ends.
+	length := len(fundamental)
+	for p, partial := range t.Partials {
+		length = max(length, partial.StartInSamples(sampleRate)+len(partials[p]))
+	}
+
+	toneSignal := make([][]float64, noOfSpeakers)
+	for o := range toneSignal {
+		toneSignal[o] = make([]float64, length)
+	}
+
+	// Append fundamental's signal.
+	for o, v := range fundamental {
+		gains := fundamentalPanner.at(o)
+		for speakerNumber := 0; speakerNumber < noOfSpeakers; speakerNumber++ {
+			// Panning.
+			panning := gains[speakerNumber]
+
+			toneSignal[speakerNumber][o] += v * t.Fundamental.Amplitude * panning
+		}
+	}
+
+	for p, partial := range t.Partials {
+		// Partials without a curve of their own follow their fundamental.
+		partialPanner := newPanner(layout, t.Panning, t.PanningCurve, partial.StartInSamples(sampleRate), sampleRate)
+		if partial.PanningCurve != nil {
+			partialPanner = newPanner(layout, t.Panning, partial.PanningCurve, 0, sampleRate)
+		}
+
+		for o, v := range partials[p] {
+			gains := partialPanner.at(o)
+			for speakerNumber := 0; speakerNumber < noOfSpeakers; speakerNumber++ {
+				// Panning.
+				panning := gains[speakerNumber]
+
+				toneSignal[speakerNumber][o+partial.StartInSamples(sampleRate)] += v * (t.Fundamental.Amplitude * partial.AmplitudeFactor) * panning
+			}
+		}
+	}
+
+	return toneSignal
 }
 
-// PartialSignal .
-func (t Tone) PartialSignal(partial mlsic.Partial) (float64, int, mlsic.Audio) {
+// panner returns the gains of the speakers for every sample of a signal.
+type panner struct {
+	layout     mlsic.Layout
+	curve      mlsic.Curve
+	offset     int
+	sampleRate int
+	gains      []float64
+}
+
+// newPanner returns a panner at panning, or moving along curve if set. offset is the
+// number of samples the signal starts after the start of the curve.
+func newPanner(layout mlsic.Layout, panning float64, curve mlsic.Curve, offset, sampleRate int) *panner {
+	return &panner{
+		layout:     layout,
+		curve:      curve,
+		offset:     offset,
+		sampleRate: sampleRate,
+		gains:      layout.Gains(panning, nil),
+	}
+}
+
+// at returns the gains of the speakers for the given sample of the signal.
+func (p *panner) at(sample int) []float64 {
+	if p.curve == nil {
+		return p.gains
+	}
+
+	panning := p.curve.At(mlsic.SamplesInDuration(p.offset+sample, p.sampleRate))
+	p.gains = p.layout.Gains(panning, p.gains)
+
+	return p.gains
+}
+
+// PartialSignal renders partial limited by mlsic.NewBandLimit of sampleRate.
+// It returns nil if the partial is above the ceiling.
+func (t Tone) PartialSignal(partial mlsic.Partial, sampleRate int) (float64, int, mlsic.Audio) {
+	return t.partialSignal(partial, nil, nil, mlsic.NewBandLimit(sampleRate), sampleRate)
+}
+
+// partialSignal renders partial with osc, limited by limit, following the
+// frequencies of glide if it is not nil.
+func (t Tone) partialSignal(partial mlsic.Partial, glide func(sample int) float64, osc oscillator.Oscillator, limit mlsic.BandLimit, sampleRate int) (float64, int, mlsic.Audio) {
 	frequency := t.Fundamental.Frequency * float64(partial.Number)
-	if frequency > mlsic.MaxFrequency {
+
+	gain := limit.Gain(frequency)
+	if glide == nil && gain == 0 {
 		return 0, 0, nil
 	}
 
 	// TODO: should partials start at zero phase or follow fundamental's
 	// at the particular point they start?
-	return signal(frequency, .0, partial.DurationInSamples())
+	var (
+		phase   float64
+		length  int
+		samples mlsic.Audio
+	)
+	if glide == nil {
+		phase, length, samples = oscillate(osc, frequency, .0, partial.DurationInSamples(sampleRate), sampleRate)
+		if gain < 1 {
+			for i := range samples {
+				samples[i] *= gain
+			}
+		}
+	} else {
+		start := partial.StartInSamples(sampleRate)
+		phase, length, samples = sweep(nil, glide, float64(partial.Number), start, .0, partial.DurationInSamples(sampleRate), limit, sampleRate)
+
+		// Gliding partials fade in and out of the roll-off band as they move.
+		for i := range samples {
+			samples[i] *= limit.Gain(float64(partial.Number) * glide(start+i))
+		}
+	}
+
+	if partial.Envelope != nil {
+		mlsic.ApplyEnvelope(samples, partial.Envelope, partial.Duration, sampleRate)
+	}
+
+	return phase, length, samples
 }
 
 // Sine holds necessary data to construct a sine wave.
@@ -462,18 +1176,23 @@ type Sine struct {
 	Amplitude float64
 	// Duration of the sine wave in milliseconds.
 	Duration time.Duration
+	// Envelope shapes the amplitude of the sine wave over its duration.
+	Envelope mlsic.Envelope
+	// Waveform of the wave. Nil is a pure sine wave. It applies to the wave
+	// itself, partials always sound as sine waves.
+	Waveform Waveform
 
 	sampleFactor float64
 	phase        float64
 }
 
-// DurationInSamples returns the assigned duration of Sine in samples.
-func (s Sine) DurationInSamples() int {
-	return mlsic.SignalLengthMultiplier * int(s.Duration.Abs().Milliseconds())
+// DurationInSamples returns the assigned duration of Sine in samples for the given sample rate.
+func (s Sine) DurationInSamples(sampleRate int) int {
+	return mlsic.DurationInSamples(s.Duration, sampleRate)
 }
 
-func signal(frequency float64, phase float64, durationInSample int) (float64, int, mlsic.Audio) {
-	sampleFactor := frequency / mlsic.SampleRate
+func signal(frequency float64, phase float64, durationInSample, sampleRate int) (float64, int, mlsic.Audio) {
+	sampleFactor := frequency / float64(sampleRate)
 
 	samples := make(mlsic.Audio, durationInSample)
 	for i := range samples {
@@ -484,6 +1203,43 @@ func signal(frequency float64, phase float64, durationInSample int) (float64, in
 	return phase, len(samples), samples
 }
 
+// oscillate is like signal but renders with osc, if it is not nil.
+func oscillate(osc oscillator.Oscillator, frequency float64, phase float64, durationInSample, sampleRate int) (float64, int, mlsic.Audio) {
+	if osc == nil {
+		return signal(frequency, phase, durationInSample, sampleRate)
+	}
+
+	samples := make(mlsic.Audio, durationInSample)
+	phase = osc.Signal(samples, frequency, phase, sampleRate)
+
+	return phase, len(samples), samples
+}
+
+// sweep is like signal but plays waveform, a sine wave if nil, and the frequency
+// of every sample is factor times frequency at the sample offset samples into the tone.
+// BandLimited waveforms follow limit.
+func sweep(waveform Waveform, frequency func(sample int) float64, factor float64, offset int, phase float64, durationInSample int, limit mlsic.BandLimit, sampleRate int) (float64, int, mlsic.Audio) {
+	if waveform == nil {
+		waveform = WaveSine
+	}
+
+	limited, _ := waveform.(BandLimited)
+
+	samples := make(mlsic.Audio, durationInSample)
+	for i := range samples {
+		f := factor * frequency(offset+i)
+		if limited != nil {
+			samples[i] = limited.SampleLimited(i, phase, f, limit, sampleRate)
+		} else {
+			samples[i] = waveform.Sample(i, phase, f, sampleRate)
+		}
+
+		_, phase = math.Modf(phase + f/float64(sampleRate))
+	}
+
+	return phase, len(samples), samples
+}
+
 func ordered[K int, V Tone](m map[K]V) (index []int) {
 	for i := range m {
 		index = append(index, int(i))
@@ -1,10 +1,19 @@
 package markov
 
 import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/bh90210/mlsic"
+	"github.com/bh90210/mlsic/master"
+	"github.com/bh90210/mlsic/oscillator"
+	"github.com/go-audio/wav"
+	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,7 +25,7 @@ func TestSignal(t *testing.T) {
 		Duration:  time.Duration(3 * time.Millisecond),
 	}
 
-	phase, length, signal := signal(sine.Frequency, .0, sine.DurationInSamples())
+	phase, length, signal := signal(sine.Frequency, .0, sine.DurationInSamples(mlsic.SampleRate), mlsic.SampleRate)
 
 	assert.Equal(t, 0.3170068027210882, phase)
 	assert.Equal(t, 132, length)
@@ -28,7 +37,623 @@ func TestDurationInSamples(t *testing.T) {
 		Duration: time.Duration(1000 * time.Millisecond),
 	}
 
-	got := sine.DurationInSamples()
+	got := sine.DurationInSamples(mlsic.SampleRate)
+	assert.Equal(t, 44100, got)
 
-	assert.Equal(t, 44000, got)
+	got = sine.DurationInSamples(48000)
+	assert.Equal(t, 48000, got)
+
+	got = sine.DurationInSamples(96000)
+	assert.Equal(t, 96000, got)
+}
+
+func TestVoiceLength(t *testing.T) {
+	voice := make(Voice)
+
+	var start time.Duration
+	for i := 0; i < 3; i++ {
+		start = voice.Place(start, Tone{
+			Fundamental: Sine{
+				Frequency: 440.,
+				Amplitude: 0.5,
+				Duration:  time.Duration(10 * time.Millisecond),
+			},
+		}, mlsic.SampleRate)
+	}
+
+	assert.Equal(t, 30*time.Millisecond, voice.End(mlsic.SampleRate))
+	assert.Equal(t, 1323, voice.LengthInSamples(mlsic.SampleRate))
+
+	signals := voice.Signals(mlsic.TwoSpeakers, mlsic.SampleRate)
+	assert.Len(t, signals, mlsic.TwoSpeakers)
+	assert.Len(t, signals[0], 1323+44100)
+
+	// Ten thousand one millisecond tones, 44.1 samples each, end exactly on the ten second sample.
+	long := make(Voice)
+	start = 0
+	for i := 0; i < 10000; i++ {
+		start = long.Place(start, Tone{Fundamental: Sine{Frequency: 440., Amplitude: 0.5, Duration: time.Millisecond}}, mlsic.SampleRate)
+	}
+
+	assert.Equal(t, 441000, long.LengthInSamples(mlsic.SampleRate))
+}
+
+func TestGenerateLength(t *testing.T) {
+	a := assert.New(t)
+
+	// Ten thousand one millisecond tones render to exactly ten seconds.
+	train := make([]Sine, 10000)
+	for i := range train {
+		train[i] = Sine{Frequency: 440., Amplitude: .5, Duration: time.Millisecond}
+	}
+
+	path := t.TempDir()
+	_, err := Generate(path, train, noHarmonics{}, 0, mlsic.SampleRate)
+	a.NoError(err)
+
+	f, err := os.Open(filepath.Join(path, "ngen00.wav"))
+	a.NoError(err)
+	defer f.Close()
+
+	buf, err := wav.NewDecoder(f).FullPCMBuffer()
+	a.NoError(err)
+	a.Len(buf.Data, 441000)
+}
+
+func TestGenerateMastering(t *testing.T) {
+	a := assert.New(t)
+
+	train := []Sine{{Frequency: 440., Amplitude: 1, Duration: 100 * time.Millisecond}}
+
+	// Peaks are limited to -1 dBFS by default.
+	report, err := Generate(t.TempDir(), train, noHarmonics{}, 0, mlsic.SampleRate)
+	a.NoError(err)
+	a.InDelta(0, report.InputPeak, .01)
+	a.LessOrEqual(report.OutputPeak, -1+1e-9)
+
+	// The mastering stage can be chosen.
+	report, err = Generate(t.TempDir(), train, noHarmonics{}, 0, mlsic.SampleRate, WithMastering(master.WithPeak(-6)))
+	a.NoError(err)
+	a.InDelta(-6, report.OutputPeak, 1e-9)
+
+	// Or left out.
+	report, err = Generate(t.TempDir(), train, noHarmonics{}, 0, mlsic.SampleRate, WithMastering())
+	a.NoError(err)
+	a.Equal(report.InputPeak, report.OutputPeak)
+}
+
+func TestNGenErrors(t *testing.T) {
+	a := assert.New(t)
+
+	s := Song{
+		NGenerations:  1,
+		SeedModelPath: filepath.Join(os.TempDir(), "mlsic-missing"),
+	}
+
+	err := s.NGen()
+	a.ErrorIs(err, os.ErrNotExist)
+	a.ErrorContains(err, "reading freq")
+
+	s.Mode = Joint
+	a.ErrorContains(s.NGen(), "reading joint")
+
+	s.Mode = Factored
+	a.ErrorContains(s.NGen(), "reading freq")
+}
+
+func TestNGenModes(t *testing.T) {
+	a := assert.New(t)
+
+	// Every frequency has its own amplitude and duration.
+	amplitudes := map[float64]float64{220.: .1, 330.: .2, 440.: .3, 550.: .4}
+	durations := map[float64]time.Duration{220.: 20 * time.Millisecond, 330.: 30 * time.Millisecond, 440.: 40 * time.Millisecond, 550.: 50 * time.Millisecond}
+
+	var train []Sine
+	for _, i := range []int{0, 1, 2, 3, 1, 0, 2, 3, 3, 1, 0, 2} {
+		f := 220. + 110.*float64(i)
+		train = append(train, Sine{Frequency: f, Amplitude: amplitudes[f], Duration: durations[f]})
+	}
+
+	for _, mode := range []Mode{Joint, Factored} {
+		m := Model{Mode: mode}
+		m.Add(train)
+
+		seed := t.TempDir()
+		a.NoError(m.Export(seed))
+
+		s := Song{
+			NGenerations:  1,
+			FilePath:      t.TempDir(),
+			ModelsPath:    t.TempDir(),
+			SeedModelPath: seed,
+			Mode:          mode,
+			Harmonics:     noHarmonics{},
+		}
+		a.NoError(s.NGen())
+
+		// The next generation is trained on the seed and the generated train,
+		// so every sine generated must have kept its amplitude and duration.
+		generation, err := s.load(filepath.Join(s.ModelsPath, "gen0"))
+		a.NoError(err)
+
+		switch mode {
+		case Joint:
+			trains, err := markovGenerator(log.Logger, generation.Joint)
+			a.NoError(err)
+			a.NotEmpty(trains)
+
+			for _, tuples := range trains {
+				for _, tuple := range tuples {
+					sine, err := parseTuple(tuple)
+					a.NoError(err)
+					a.Equal(amplitudes[sine.Frequency], sine.Amplitude, tuple)
+					a.Equal(durations[sine.Frequency], sine.Duration, tuple)
+				}
+			}
+
+		case Factored:
+			for f, amplitude := range amplitudes {
+				a.Len(generation.AmpGivenFreq.Counts[fmt.Sprintf("%f", f)], 1)
+				a.Contains(generation.AmpGivenFreq.Counts[fmt.Sprintf("%f", f)], fmt.Sprintf("%f", amplitude))
+				a.Contains(generation.DurGivenFreq.Counts[fmt.Sprintf("%f", f)], fmt.Sprintf("%v", durations[f].Milliseconds()))
+			}
+
+			// Generations add to the counts of the seed.
+			a.Greater(generation.AmpGivenFreq.Counts["220.000000"]["0.100000"], 3)
+		}
+	}
+}
+
+func TestDeconstructReader(t *testing.T) {
+	a := assert.New(t)
+
+	var poly []Voice
+	for v := 0; v < 3; v++ {
+		voice := make(Voice)
+
+		var index int
+		for i := 0; i < 4; i++ {
+			voice[index] = Tone{
+				Fundamental: Sine{
+					Frequency: 220. * float64(v+i+1),
+					Amplitude: 0.2,
+					Duration:  time.Duration(5+v) * time.Millisecond,
+				},
+				Partials: []mlsic.Partial{
+					{Number: 2, AmplitudeFactor: 0.5, Start: time.Millisecond, Duration: 2 * time.Millisecond},
+				},
+				Panning: 0.3 * float64(v),
+			}
+
+			// Overlap the tones of the voice.
+			index += voice[index].Fundamental.DurationInSamples(mlsic.SampleRate) - 30
+		}
+
+		poly = append(poly, voice)
+	}
+
+	want, err := Deconstruct(poly, mlsic.Ring(3))
+	a.NoError(err)
+
+	r, err := NewDeconstructReader(poly, mlsic.Ring(3))
+	a.NoError(err)
+	a.Equal(3, r.Channels())
+	a.Equal(len(want[0]), r.Length())
+
+	// Read in chunks that do not line up with the tones.
+	var frames mlsic.Audio
+	buf := make(mlsic.Audio, 3*37)
+	for {
+		n, err := r.Read(buf)
+		frames = append(frames, buf[:n]...)
+
+		if err != nil {
+			a.ErrorIs(err, io.EOF)
+			break
+		}
+	}
+
+	a.Equal(want, mlsic.Deinterleave(frames, 3))
+
+	_, err = NewDeconstructReader(poly, mlsic.Layout{})
+	a.ErrorIs(err, ErrNotEnoughSpeakers)
+}
+
+func TestDeconstructPanLaw(t *testing.T) {
+	a := assert.New(t)
+
+	voice := Voice{
+		0: Tone{
+			Fundamental: Sine{
+				Frequency: 440.,
+				Amplitude: 1,
+				Duration:  time.Duration(10 * time.Millisecond),
+			},
+			Panning: 0.5,
+		},
+	}
+
+	linear, err := Deconstruct([]Voice{voice}, mlsic.Stereo())
+	a.NoError(err)
+
+	equalPower, err := Deconstruct([]Voice{voice}, mlsic.Stereo(), WithPanLaw(mlsic.EqualPowerPanLaw))
+	a.NoError(err)
+
+	for i, v := range linear[0] {
+		a.InDelta(v*math.Sqrt2, equalPower[0][i], 1e-9)
+		a.InDelta(v*math.Sqrt2, equalPower[1][i], 1e-9)
+	}
+}
+
+func TestDeconstructVBAP(t *testing.T) {
+	a := assert.New(t)
+
+	voice := Voice{
+		0: Tone{
+			Fundamental: Sine{
+				Frequency: 440.,
+				Amplitude: 1,
+				Duration:  time.Duration(10 * time.Millisecond),
+			},
+			Panning: 0.6,
+		},
+	}
+
+	// Four speakers at 45, 135, 225 and 315 degrees.
+	layout := mlsic.Ring(4)
+
+	vbap, err := Deconstruct([]Voice{voice}, layout, WithVBAP())
+	a.NoError(err)
+
+	// At 216 degrees the tone is between the second and the third
+	// speaker, leaning to the third, with constant power.
+	gains := layout
+	gains.VBAP = true
+	want := gains.Gains(0.6, nil)
+	a.Zero(want[0])
+	a.Zero(want[3])
+	a.Greater(want[2], want[1])
+	a.InDelta(1., want[1]*want[1]+want[2]*want[2], 1e-9)
+
+	mono, err := Deconstruct([]Voice{voice}, mlsic.Mono())
+	a.NoError(err)
+
+	for speaker, gain := range want {
+		for i, v := range mono[0] {
+			a.InDelta(v*gain, vbap[speaker][i], 1e-9)
+		}
+	}
+
+	// A pan law overrides the VBAP of the layout.
+	linear, err := Deconstruct([]Voice{voice}, layout)
+	a.NoError(err)
+
+	overridden, err := Deconstruct([]Voice{voice}, gains, WithPanLaw(mlsic.LinearPanLaw))
+	a.NoError(err)
+	a.Equal(linear, overridden)
+}
+
+func TestDeconstructPanningCurve(t *testing.T) {
+	a := assert.New(t)
+
+	duration := 100 * time.Millisecond
+
+	voice := Voice{
+		0: Tone{
+			Fundamental: Sine{
+				Frequency: 100.,
+				Amplitude: 1,
+				Duration:  duration,
+			},
+			// Sweep from left to right.
+			PanningCurve: mlsic.Breakpoints{{Time: 0, Value: 0}, {Time: duration, Value: 1}},
+			Partials: []mlsic.Partial{
+				// Follows the fundamental.
+				{Number: 2, AmplitudeFactor: 1, Start: duration / 2, Duration: duration / 4},
+				// Stays on the right.
+				{Number: 3, AmplitudeFactor: 1, Duration: duration, PanningCurve: mlsic.CurveFunc(func(time.Duration) float64 {
+					return 1
+				})},
+			},
+		},
+	}
+
+	speakers, err := Deconstruct([]Voice{voice}, mlsic.Stereo())
+	a.NoError(err)
+
+	_, length, fundamental := voice[0].Signal(mlsic.SampleRate)
+	_, _, second := voice[0].PartialSignal(voice[0].Partials[0], mlsic.SampleRate)
+	_, _, third := voice[0].PartialSignal(voice[0].Partials[1], mlsic.SampleRate)
+
+	start := voice[0].Partials[0].StartInSamples(mlsic.SampleRate)
+
+	for i := 0; i < length; i++ {
+		panning := voice[0].PanningCurve.At(mlsic.SamplesInDuration(i, mlsic.SampleRate))
+
+		left := fundamental[i] * (1 - panning)
+		right := fundamental[i]*panning + third[i]
+		if i >= start && i < start+len(second) {
+			left += second[i-start] * (1 - panning)
+			right += second[i-start] * panning
+		}
+
+		a.InDelta(left, speakers[0][i], 1e-9, i)
+		a.InDelta(right, speakers[1][i], 1e-9, i)
+	}
+}
+
+func TestToneEnvelope(t *testing.T) {
+	a := assert.New(t)
+
+	tone := Tone{
+		Fundamental: Sine{
+			Frequency: 440.,
+			Duration:  20 * time.Millisecond,
+			Envelope:  mlsic.ADSR{Attack: 5 * time.Millisecond, Sustain: 1, Release: 5 * time.Millisecond},
+		},
+		Partials: []mlsic.Partial{
+			{Number: 2, Duration: 10 * time.Millisecond, Envelope: mlsic.Breakpoints{{Value: 1}, {Time: 10 * time.Millisecond, Value: 0}}},
+		},
+	}
+
+	_, length, got := tone.Signal(mlsic.SampleRate)
+	_, _, raw := signal(440., 0, length, mlsic.SampleRate)
+
+	// No clicks at either end.
+	a.Zero(got[0])
+	a.InDelta(0, got[length-1], 1e-2)
+	a.Equal(raw[length/2], got[length/2])
+
+	_, partialLength, partial := tone.PartialSignal(tone.Partials[0], mlsic.SampleRate)
+	_, _, rawPartial := signal(880., 0, partialLength, mlsic.SampleRate)
+
+	a.Equal(rawPartial[0], partial[0])
+	a.InDelta(rawPartial[partialLength/2]/2, partial[partialLength/2], 1e-3)
+	a.InDelta(0, partial[partialLength-1], 1e-2)
+}
+
+func TestToneGlide(t *testing.T) {
+	a := assert.New(t)
+
+	tone := Tone{
+		Fundamental: Sine{Frequency: 440., Duration: 20 * time.Millisecond},
+		Glide:       Glide{Duration: 10 * time.Millisecond},
+	}
+	length := tone.Fundamental.DurationInSamples(mlsic.SampleRate)
+
+	glide := tone.glide(880., mlsic.SampleRate)
+	a.Equal(440., glide(0))
+	a.Equal(440., glide(length/2))
+	a.InDelta(880., glide(length-1), 2)
+	a.InDelta(880., glide(length), 1e-9)
+
+	// Without a next tone or a glide duration the tone holds its frequency.
+	a.Nil(tone.glide(0, mlsic.SampleRate))
+	a.Nil(Tone{Fundamental: tone.Fundamental}.glide(880., mlsic.SampleRate))
+
+	_, _, held := tone.Signal(mlsic.SampleRate)
+	phase, _, swept := tone.GlideSignal(880., mlsic.SampleRate)
+	a.Equal(held[:length/2], swept[:length/2])
+
+	// The phase carries over into the next tone without a jump.
+	next := Tone{Fundamental: Sine{Frequency: 880., Duration: 20 * time.Millisecond}}
+	_, _, following := next.Signal(mlsic.SampleRate, phase)
+	step := 2 * math.Pi * 880. / float64(mlsic.SampleRate)
+	a.LessOrEqual(math.Abs(following[0]-swept[length-1]), step)
+}
+
+func TestWaveform(t *testing.T) {
+	a := assert.New(t)
+
+	// A sine waveform sounds the same as no waveform at all.
+	tone := Tone{Fundamental: Sine{Frequency: 440., Duration: 10 * time.Millisecond}}
+	_, _, want := tone.Signal(mlsic.SampleRate)
+	tone.Fundamental.Waveform = WaveSine
+	_, _, got := tone.Signal(mlsic.SampleRate)
+	a.Equal(want, got)
+
+	// Band-limited waveforms only keep the harmonics below mlsic.MaxFrequency.
+	saw := WaveSaw.(*Wavetable)
+	ceiling := mlsic.NewBandLimit(mlsic.SampleRate).Ceiling
+	a.Equal(len(saw.sin), saw.harmonics(1., ceiling))
+	a.Equal(1, saw.harmonics(mlsic.MaxFrequency, ceiling))
+	a.Zero(saw.harmonics(mlsic.MaxFrequency+1, ceiling))
+	a.Equal(1, saw.harmonics(8000., mlsic.NewBandLimit(16000).Ceiling))
+
+	// At the top of the range every waveform turns into a sine wave.
+	for _, w := range []Waveform{WaveTriangle, WaveSquare, WaveSaw} {
+		a.InDelta(0, w.Sample(0, 0, mlsic.MaxFrequency, mlsic.SampleRate), 1e-9)
+		peak := w.Sample(0, .25, mlsic.MaxFrequency, mlsic.SampleRate)
+		a.InDelta(-peak, w.Sample(0, .75, mlsic.MaxFrequency, mlsic.SampleRate), 1e-2*math.Abs(peak)+1e-9, "%T", w)
+	}
+
+	// A user wavetable plays back its cycle.
+	cycle := make([]float64, 64)
+	for i := range cycle {
+		cycle[i] = math.Sin(2*math.Pi*float64(i)/64) + .5*math.Sin(2*math.Pi*3*float64(i)/64)
+	}
+	table := NewWavetable(cycle)
+	for i := 0; i < 64; i += 8 {
+		a.InDelta(cycle[i], table.Sample(0, float64(i)/64, 100., mlsic.SampleRate), 1e-3)
+	}
+	// The third harmonic is dropped when it would sound above mlsic.MaxFrequency.
+	a.InDelta(math.Sin(2*math.Pi/8), table.Sample(0, 1./8, mlsic.MaxFrequency/2, mlsic.SampleRate), 1e-3)
+
+	// Noise is deterministic and stays within range.
+	noise := Noise{Seed: 7}
+	for i := 0; i < 1000; i++ {
+		v := noise.Sample(i, 0, 440., mlsic.SampleRate)
+		a.GreaterOrEqual(v, -1.)
+		a.Less(v, 1.)
+		a.Equal(v, noise.Sample(i, .5, 440., mlsic.SampleRate))
+	}
+	a.NotEqual(noise.Sample(0, 0, 440., mlsic.SampleRate), noise.Sample(1, 0, 440., mlsic.SampleRate))
+
+	// Wavetables are shared by the workers of Deconstruct.
+	var poly []Voice
+	for v := 0; v < 8; v++ {
+		poly = append(poly, Voice{0: Tone{Fundamental: Sine{Frequency: 110. * float64(v+1), Amplitude: .1, Duration: 20 * time.Millisecond, Waveform: WaveSaw}}})
+	}
+
+	serial, err := Deconstruct(poly, mlsic.Stereo(), WithWorkers(1))
+	a.NoError(err)
+	concurrent, err := Deconstruct(poly, mlsic.Stereo(), WithWorkers(8))
+	a.NoError(err)
+	a.Equal(serial, concurrent)
+}
+
+func TestDeconstructOscillator(t *testing.T) {
+	a := assert.New(t)
+
+	poly := []Voice{{
+		0:    Tone{Fundamental: Sine{Frequency: 440., Amplitude: .5, Duration: 50 * time.Millisecond}, Partials: []mlsic.Partial{{Number: 3, AmplitudeFactor: .5, Duration: 20 * time.Millisecond}}},
+		2205: Tone{Fundamental: Sine{Frequency: 660., Amplitude: .5, Duration: 50 * time.Millisecond}},
+	}}
+
+	want, err := Deconstruct(poly, mlsic.Stereo())
+	a.NoError(err)
+
+	for _, o := range []oscillator.Oscillator{oscillator.Exact, oscillator.Table, oscillator.Recursive} {
+		got, err := Deconstruct(poly, mlsic.Stereo(), WithOscillator(o))
+		a.NoError(err)
+		a.Len(got, len(want))
+
+		for c := range want {
+			a.Len(got[c], len(want[c]))
+			for i := range want[c] {
+				a.InDelta(want[c][i], got[c][i], 2*o.Tolerance()+1e-12)
+			}
+		}
+	}
+}
+
+// partials is the number of partials of the tone in the benchmarks.
+const partials = 32
+
+func BenchmarkSignal(b *testing.B) {
+	length := mlsic.DurationInSamples(time.Second, mlsic.SampleRate)
+
+	b.Run("signal", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			signal(440., 0, length, mlsic.SampleRate)
+		}
+	})
+
+	for name, o := range map[string]oscillator.Oscillator{"exact": oscillator.Exact, "table": oscillator.Table, "recursive": oscillator.Recursive} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				oscillate(o, 440., 0, length, mlsic.SampleRate)
+			}
+		})
+	}
+}
+
+func BenchmarkDeconstruct(b *testing.B) {
+	tone := Tone{Fundamental: Sine{Frequency: 110., Amplitude: .1, Duration: time.Second}}
+	for n := 2; n < partials+2; n++ {
+		tone.Partials = append(tone.Partials, mlsic.Partial{Number: n, AmplitudeFactor: 1 / float64(n), Duration: time.Second})
+	}
+
+	poly := []Voice{{0: tone}}
+
+	for name, o := range map[string]oscillator.Oscillator{"signal": nil, "table": oscillator.Table, "recursive": oscillator.Recursive} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := Deconstruct(poly, mlsic.Stereo(), WithOscillator(o)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestDeconstructWorkers(t *testing.T) {
+	a := assert.New(t)
+
+	var poly []Voice
+	for v := 0; v < 4; v++ {
+		voice := make(Voice)
+		for n := 0; n < 6; n++ {
+			tone := Tone{
+				Fundamental: Sine{Frequency: 110. * float64(v+n+1), Amplitude: .1, Duration: 30 * time.Millisecond},
+				Panning:     float64(v) / 4,
+				Glide:       Glide{Duration: 10 * time.Millisecond},
+			}
+			for p := 2; p < 6; p++ {
+				tone.Partials = append(tone.Partials, mlsic.Partial{Number: p, AmplitudeFactor: .5, Duration: 20 * time.Millisecond, Start: time.Duration(p) * time.Millisecond})
+			}
+
+			voice[n*1000+v*7] = tone
+		}
+
+		poly = append(poly, voice)
+	}
+
+	want, err := Deconstruct(poly, mlsic.Ring(3), WithWorkers(1))
+	a.NoError(err)
+
+	for _, workers := range []int{2, 3, 16} {
+		got, err := Deconstruct(poly, mlsic.Ring(3), WithWorkers(workers))
+		a.NoError(err)
+		a.Equal(want, got, "%d workers", workers)
+	}
+
+	_, err = Deconstruct(poly, mlsic.Ring(3), WithWorkers(0))
+	a.ErrorIs(err, ErrWorkers)
+}
+
+func TestDeconstructBandLimit(t *testing.T) {
+	a := assert.New(t)
+
+	tone := Tone{
+		Fundamental: Sine{Frequency: 1000., Amplitude: .5, Duration: 20 * time.Millisecond},
+		Partials: []mlsic.Partial{
+			{Number: 3, AmplitudeFactor: 1, Duration: 20 * time.Millisecond},
+			{Number: 9, AmplitudeFactor: 1, Duration: 20 * time.Millisecond},
+		},
+	}
+
+	fundamental := Tone{Fundamental: tone.Fundamental}
+	want, err := Deconstruct([]Voice{{0: fundamental}}, mlsic.Mono())
+	a.NoError(err)
+
+	// Both partials are above the ceiling.
+	got, err := Deconstruct([]Voice{{0: tone}}, mlsic.Mono(), WithBandLimit(mlsic.BandLimit{Ceiling: 2500}))
+	a.NoError(err)
+	a.Equal(want, got)
+
+	// The third partial sits in the middle of the roll-off band and sounds at half its amplitude.
+	tone.Partials = tone.Partials[:1]
+	got, err = Deconstruct([]Voice{{0: tone}}, mlsic.Mono(), WithBandLimit(mlsic.BandLimit{Ceiling: 4000, RollOff: 2000}))
+	a.NoError(err)
+
+	_, _, partial := tone.PartialSignal(tone.Partials[0], mlsic.SampleRate)
+	for i := range partial {
+		a.InDelta(want[0][i]+partial[i]*.5*.5, got[0][i], 1e-12)
+	}
+
+	for _, limit := range []mlsic.BandLimit{{Ceiling: -1}, {Ceiling: mlsic.SampleRate}, {Ceiling: 1000, RollOff: -1}} {
+		_, err = Deconstruct([]Voice{{0: tone}}, mlsic.Mono(), WithBandLimit(limit))
+		a.ErrorIs(err, ErrBandLimit)
+
+		_, err = Generate(t.TempDir(), []Sine{tone.Fundamental}, noHarmonics{}, 0, mlsic.SampleRate, WithTrainBandLimit(limit))
+		a.ErrorIs(err, ErrBandLimit)
+	}
+
+	// Waveforms follow the band limit too. Below 2500 Hz a 1000 Hz saw is left
+	// with its first two harmonics, the second in the middle of the roll-off band.
+	saw := tone
+	saw.Partials = nil
+	saw.Fundamental.Waveform = WaveSaw
+	limit := mlsic.BandLimit{Ceiling: 2500, RollOff: 1000}
+
+	got, err = Deconstruct([]Voice{{0: saw}}, mlsic.Mono(), WithBandLimit(limit))
+	a.NoError(err)
+
+	harmonics := WaveSaw.(*Wavetable).sin
+	for i := 0; i < saw.Fundamental.DurationInSamples(mlsic.SampleRate); i++ {
+		phase := 1000. * float64(i) / mlsic.SampleRate
+		v := harmonics[0]*math.Sin(2*math.Pi*phase) + .5*harmonics[1]*math.Sin(4*math.Pi*phase)
+		a.InDelta(.5*v, got[0][i], 1e-3)
+	}
 }
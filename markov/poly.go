@@ -0,0 +1,223 @@
+package markov
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bh90210/mlsic"
+	"github.com/mb-14/gomarkov"
+)
+
+// ErrPolyEvent is returned when a state of a Poly chain is not a polyphonic event.
+var ErrPolyEvent = errors.New("state is not a polyphonic event")
+
+// ErrPolyVersion is returned when a polyphonic event is not of PolyVersion.
+var ErrPolyVersion = errors.New("unsupported polyphonic event version")
+
+// ErrMaxEvents is returned when GeneratePoly is asked for less than one event.
+var ErrMaxEvents = errors.New("maximum number of events must be above zero")
+
+// PolyVersion is the version of the PolyEvent encoding.
+const PolyVersion = 1
+
+// PolyEvent is a state of a Poly chain, the start of a tone or of one of its partials.
+//
+// A piece is a sequence of events. The tones of all voices share a single timeline and
+// are ordered by their start, each followed by the events of its partials, so that the
+// onset of a tone is counted from the start of the previous tone and the onset of a
+// partial from the start of its own tone.
+//
+// An event is written as "v1 onset voice partial frequency amplitude duration panning",
+// where v1 is the PolyVersion.
+type PolyEvent struct {
+	// Onset in samples, from the start of the previous tone for a tone
+	// and from the start of its tone for a partial.
+	Onset int
+	// Voice is the position in the []Voice of the voice the event belongs to.
+	Voice int
+	// Partial is the number of the partial, zero for the fundamental of a tone.
+	Partial int
+	// Frequency and Amplitude the event sounds at.
+	Frequency float64
+	Amplitude float64
+	// Duration in samples.
+	Duration int
+	// Panning of the tone.
+	Panning float64
+}
+
+// String encodes the event as a state of a Poly chain.
+func (e PolyEvent) String() string {
+	return fmt.Sprintf("v%d %d %d %d %f %f %d %f",
+		PolyVersion, e.Onset, e.Voice, e.Partial, e.Frequency, e.Amplitude, e.Duration, e.Panning)
+}
+
+// ParsePolyEvent parses a state of a Poly chain written by PolyEvent.String.
+func ParsePolyEvent(st string) (PolyEvent, error) {
+	fields := strings.Fields(st)
+	if len(fields) == 0 {
+		return PolyEvent{}, fmt.Errorf("%w: %q", ErrPolyEvent, st)
+	}
+
+	if fields[0] != "v"+strconv.Itoa(PolyVersion) {
+		return PolyEvent{}, fmt.Errorf("%w: %q", ErrPolyVersion, st)
+	}
+
+	if len(fields) != 8 {
+		return PolyEvent{}, fmt.Errorf("%w: %q", ErrPolyEvent, st)
+	}
+
+	// Onset, voice, partial and duration are counts.
+	var ints [4]int
+	for i, field := range []string{fields[1], fields[2], fields[3], fields[6]} {
+		v, err := strconv.Atoi(field)
+		if err != nil || v < 0 {
+			return PolyEvent{}, fmt.Errorf("%w: %q", ErrPolyEvent, st)
+		}
+
+		ints[i] = v
+	}
+
+	values, err := parseState(strings.Join([]string{fields[4], fields[5], fields[7]}, " "))
+	if err != nil {
+		return PolyEvent{}, err
+	}
+
+	return PolyEvent{
+		Onset:     ints[0],
+		Voice:     ints[1],
+		Partial:   ints[2],
+		Frequency: values[0],
+		Amplitude: values[1],
+		Duration:  ints[3],
+		Panning:   values[2],
+	}, nil
+}
+
+// GeneratePoly samples the Poly chain into voices. It starts where the trained pieces
+// start and stops where one of them ends, or after maxEvents events.
+func (m *Model) GeneratePoly(prng gomarkov.PRNG, maxEvents, sampleRate int) ([]Voice, error) {
+	if maxEvents < 1 {
+		return nil, ErrMaxEvents
+	}
+
+	m.nilCheck(true)
+
+	order, err := chainOrder(m.Poly)
+	if err != nil {
+		return nil, err
+	}
+
+	current := make(gomarkov.NGram, order)
+	for i := range current {
+		current[i] = gomarkov.StartToken
+	}
+
+	var events []PolyEvent
+	for len(events) < maxEvents {
+		next, err := m.Poly.GenerateDeterministic(current, prng)
+		if err != nil {
+			return nil, fmt.Errorf("generating next event: %w", err)
+		}
+
+		if next == gomarkov.EndToken {
+			break
+		}
+
+		event, err := ParsePolyEvent(next)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+
+		current = append(slices.Clone(current[1:]), next)
+	}
+
+	return polyVoices(events, sampleRate), nil
+}
+
+// polyVoices assembles events into voices. A partial belongs to the last tone of its
+// voice and is left out if the voice has no tone yet, as generated sequences may have.
+func polyVoices(events []PolyEvent, sampleRate int) []Voice {
+	var voices []Voice
+	// last holds the index of the last tone of each voice, -1 if it has none.
+	var last []int
+
+	var onset int
+	for _, e := range events {
+		for len(voices) <= e.Voice {
+			voices = append(voices, make(Voice))
+			last = append(last, -1)
+		}
+
+		if e.Partial > 0 {
+			index := last[e.Voice]
+			if index < 0 {
+				continue
+			}
+
+			tone := voices[e.Voice][index]
+
+			var factor float64
+			if tone.Fundamental.Amplitude != 0 {
+				factor = e.Amplitude / tone.Fundamental.Amplitude
+			}
+
+			tone.Partials = append(tone.Partials, mlsic.Partial{
+				Number:          e.Partial,
+				AmplitudeFactor: factor,
+				Start:           mlsic.SamplesInDuration(e.Onset, sampleRate),
+				Duration:        mlsic.SamplesInDuration(e.Duration, sampleRate),
+			})
+
+			voices[e.Voice][index] = tone
+
+			continue
+		}
+
+		// Onsets are whole samples between tone starts taken from absolute
+		// positions, so adding them up lands every tone where it was.
+		onset += e.Onset
+
+		voices[e.Voice][onset] = Tone{
+			Fundamental: Sine{
+				Frequency: e.Frequency,
+				Amplitude: e.Amplitude,
+				Duration:  mlsic.SamplesInDuration(e.Duration, sampleRate),
+			},
+			Panning: e.Panning,
+		}
+
+		last[e.Voice] = onset
+	}
+
+	return voices
+}
+
+// chainOrder returns the number of states chain generates from.
+func chainOrder(chain Chain) (int, error) {
+	switch c := chain.(type) {
+	case *gomarkov.Chain:
+		return c.Order, nil
+
+	case *Backoff:
+		return c.Order(), nil
+	}
+
+	data, err := chain.MarshalJSON()
+	if err != nil {
+		return 0, fmt.Errorf("marshal chain: %w", err)
+	}
+
+	var m model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return 0, fmt.Errorf("unmarshal chain: %w", err)
+	}
+
+	return max(m.Int, 1), nil
+}
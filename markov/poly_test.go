@@ -0,0 +1,227 @@
+package markov
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bh90210/mlsic"
+	"github.com/bh90210/mlsic/master"
+	"github.com/stretchr/testify/assert"
+)
+
+// polyPiece returns two voices, the first with a partial in each tone.
+func polyPiece() []Voice {
+	first := Voice{
+		0: {
+			Fundamental: Sine{Frequency: 220, Amplitude: .5, Duration: 10 * time.Millisecond},
+			Partials: []mlsic.Partial{
+				{Number: 2, AmplitudeFactor: .5, Duration: 10 * time.Millisecond},
+			},
+			Panning: .25,
+		},
+		480: {
+			Fundamental: Sine{Frequency: 330, Amplitude: .25, Duration: 20 * time.Millisecond},
+			Partials: []mlsic.Partial{
+				{Number: 3, AmplitudeFactor: .5, Start: 5 * time.Millisecond, Duration: 5 * time.Millisecond},
+			},
+			Panning: .5,
+		},
+	}
+
+	second := Voice{
+		240: {
+			Fundamental: Sine{Frequency: 110, Amplitude: .75, Duration: 15 * time.Millisecond},
+			Panning:     1,
+		},
+		960: {
+			Fundamental: Sine{Frequency: 165, Amplitude: .5, Duration: 5 * time.Millisecond},
+		},
+	}
+
+	return []Voice{first, second}
+}
+
+func TestGeneratePoly(t *testing.T) {
+	a := assert.New(t)
+
+	poly := polyPiece()
+
+	m := Model{}
+	m.AddPoly(poly, 48000)
+
+	// A single piece of distinct events is sampled back as it was.
+	voices, err := m.GeneratePoly(rand.New(rand.NewSource(420)), DefaultMaxEvents, 48000)
+	a.NoError(err)
+	a.Equal(poly, voices)
+
+	// Generation stops after the maximum number of events.
+	voices, err = m.GeneratePoly(rand.New(rand.NewSource(420)), 1, 48000)
+	a.NoError(err)
+	a.Len(voices, 1)
+	a.Len(voices[0], 1)
+
+	_, err = m.GeneratePoly(rand.New(rand.NewSource(420)), 0, 48000)
+	a.ErrorIs(err, ErrMaxEvents)
+
+	// Back-off chains sample the same way.
+	b := Model{Backoff: true, Orders: Orders{Poly: 3}}
+	b.AddPoly(poly, 48000)
+
+	voices, err = b.GeneratePoly(rand.New(rand.NewSource(420)), DefaultMaxEvents, 48000)
+	a.NoError(err)
+	a.Equal(poly, voices)
+}
+
+func TestGeneratePolyDeconstruct(t *testing.T) {
+	a := assert.New(t)
+
+	// A partial starting within its tone and sounding well past its end.
+	poly := []Voice{{
+		0: {
+			Fundamental: Sine{Frequency: 55, Amplitude: 1, Duration: 5 * time.Millisecond},
+			Partials: []mlsic.Partial{
+				{Number: 4, AmplitudeFactor: .25, Start: 2 * time.Millisecond, Duration: 20 * time.Millisecond},
+			},
+		},
+	}}
+
+	m := Model{}
+	m.AddPoly(poly, 48000)
+
+	voices, err := m.GeneratePoly(rand.New(rand.NewSource(420)), DefaultMaxEvents, 48000)
+	a.NoError(err)
+	a.Equal(poly, voices)
+
+	speakers, err := Deconstruct(voices, mlsic.Mono(), WithSampleRate(48000))
+	a.NoError(err)
+	a.Len(speakers, 1)
+
+	// The partial keeps sounding after the fundamental ends at 240 samples
+	// and the piece lasts until it ends, followed by a second of silence.
+	a.Len(speakers[0], 96+960+48000)
+	a.NotZero(master.Peak([]mlsic.Audio{speakers[0][240 : 96+960]}))
+}
+
+func TestAddPoly(t *testing.T) {
+	a := assert.New(t)
+
+	poly := polyPiece()
+	// A tone starting along with one of the first voice, with a partial
+	// sounding past the start of the next tone of its voice.
+	poly[1][480] = Tone{
+		Fundamental: Sine{Frequency: 55, Amplitude: 1, Duration: 5 * time.Millisecond},
+		Partials: []mlsic.Partial{
+			{Number: 4, AmplitudeFactor: .25, Start: 2 * time.Millisecond, Duration: 20 * time.Millisecond},
+		},
+	}
+
+	m := Model{}
+
+	// Every tone is an event once, followed by its partials.
+	a.Equal([]PolyEvent{
+		{Onset: 0, Voice: 0, Frequency: 220, Amplitude: .5, Duration: 480, Panning: .25},
+		{Onset: 0, Voice: 0, Partial: 2, Frequency: 440, Amplitude: .25, Duration: 480, Panning: .25},
+		{Onset: 240, Voice: 1, Frequency: 110, Amplitude: .75, Duration: 720, Panning: 1},
+		{Onset: 240, Voice: 0, Frequency: 330, Amplitude: .25, Duration: 960, Panning: .5},
+		{Onset: 240, Voice: 0, Partial: 3, Frequency: 990, Amplitude: .125, Duration: 240, Panning: .5},
+		{Onset: 0, Voice: 1, Frequency: 55, Amplitude: 1, Duration: 240},
+		{Onset: 96, Voice: 1, Partial: 4, Frequency: 220, Amplitude: .25, Duration: 960},
+		{Onset: 480, Voice: 1, Frequency: 165, Amplitude: .5, Duration: 240},
+	}, m.polyEvents(poly, 48000))
+
+	// The piece round-trips through the model.
+	m.AddPoly(poly, 48000)
+
+	voices, err := m.GeneratePoly(rand.New(rand.NewSource(420)), DefaultMaxEvents, 48000)
+	a.NoError(err)
+	a.Equal(poly, voices)
+
+	// And renders, the partial outlasting its tone included.
+	speakers, err := Deconstruct(voices, mlsic.Stereo(), WithSampleRate(48000))
+	a.NoError(err)
+	a.Len(speakers, 2)
+	// The partial of the tone at 480 ends after the last tone of the piece.
+	a.Len(speakers[0], 480+96+960+48000)
+
+	// Quantizers apply to the events.
+	q := Model{Quantizers: Quantizers{Freq: Cents{Step: 100}, Pan: Sectors{N: 2}}}
+	events := q.polyEvents([]Voice{{0: {Fundamental: Sine{Frequency: 445, Amplitude: 1, Duration: time.Millisecond}, Panning: .3}}}, 48000)
+	a.Len(events, 1)
+	a.InDelta(440, events[0].Frequency, 1e-9)
+	a.Equal(48, events[0].Duration)
+}
+
+func TestPolyEvent(t *testing.T) {
+	a := assert.New(t)
+
+	e := PolyEvent{Onset: 240, Voice: 1, Partial: 3, Frequency: 330, Amplitude: .75, Duration: 720, Panning: 1}
+	a.Equal("v1 240 1 3 330.000000 0.750000 720 1.000000", e.String())
+
+	parsed, err := ParsePolyEvent(e.String())
+	a.NoError(err)
+	a.Equal(e, parsed)
+
+	for _, st := range []string{
+		"v2 240 1 3 330.000000 0.750000 720 1.000000",
+		"240 1 330.000000 0.750000 720 1.000000",
+	} {
+		_, err := ParsePolyEvent(st)
+		a.ErrorIs(err, ErrPolyVersion, st)
+	}
+
+	for _, st := range []string{
+		"",
+		"v1 240 1 330.000000 0.750000 720 1.000000",
+		"v1 -1 1 3 330.000000 0.750000 720 1.000000",
+		"v1 240 -1 3 330.000000 0.750000 720 1.000000",
+		"v1 240 1 -3 330.000000 0.750000 720 1.000000",
+		"v1 240 1 3 330.000000 0.750000 -720 1.000000",
+		"v1 240 1 3 330.000000 0.750000 720.5 1.000000",
+	} {
+		_, err := ParsePolyEvent(st)
+		a.ErrorIs(err, ErrPolyEvent, st)
+	}
+
+	// Partials of voices without a tone are left out.
+	a.Equal([]Voice{{}, {0: {Fundamental: Sine{Frequency: 110, Amplitude: 1, Duration: 10 * time.Millisecond}}}}, polyVoices([]PolyEvent{
+		{Voice: 0, Partial: 2, Frequency: 220, Amplitude: 1, Duration: 480},
+		{Voice: 1, Frequency: 110, Amplitude: 1, Duration: 480},
+	}, 48000))
+}
+
+func TestPolyGen(t *testing.T) {
+	a := assert.New(t)
+
+	m := Model{}
+	m.AddPoly(polyPiece(), mlsic.SampleRate)
+
+	seed := t.TempDir()
+	a.NoError(m.Export(seed))
+
+	s := Song{
+		NGenerations:  2,
+		FilePath:      t.TempDir(),
+		ModelsPath:    t.TempDir(),
+		SeedModelPath: seed,
+	}
+	a.NoError(s.PolyGen())
+
+	// Every generation is mastered, limiting its peaks to -1 dBFS.
+	a.Len(s.Reports, 2)
+	for _, r := range s.Reports {
+		a.LessOrEqual(r.OutputPeak, -1+1e-9)
+	}
+
+	// A file per speaker of the stereo layout for every generation.
+	for _, name := range []string{"polygen00.wav", "polygen01.wav", "polygen10.wav", "polygen11.wav"} {
+		a.FileExists(filepath.Join(s.FilePath, name))
+	}
+
+	a.FileExists(filepath.Join(s.ModelsPath, "gen1", "poly.json"))
+
+	s.SeedModelPath = t.TempDir()
+	a.ErrorIs(s.PolyGen(), os.ErrNotExist)
+}
@@ -0,0 +1,177 @@
+package markov
+
+import (
+	"math"
+	"time"
+)
+
+// Quantizer snaps a continuous value to a grid, so that values close to each
+// other become the same Markov state instead of sparse distinct ones.
+type Quantizer interface {
+	Quantize(v float64) float64
+}
+
+// QuantizerFunc is a function used as a Quantizer.
+type QuantizerFunc func(v float64) float64
+
+// Quantize implements Quantizer.
+func (f QuantizerFunc) Quantize(v float64) float64 {
+	return f(v)
+}
+
+// Quantizers holds the quantizer of each dimension of a Model. Training and generation
+// both go through them. A nil Quantizer leaves its values as they are.
+type Quantizers struct {
+	// Freq quantizes frequencies in Hz.
+	Freq Quantizer
+	// Amp quantizes linear amplitudes.
+	Amp Quantizer
+	// Dur quantizes durations in milliseconds, the unit they are modelled in.
+	Dur Quantizer
+	// Pan quantizes panning.
+	Pan Quantizer
+}
+
+func (q Quantizers) frequency(f float64) float64 {
+	return quantize(q.Freq, f)
+}
+
+func (q Quantizers) amplitude(a float64) float64 {
+	return quantize(q.Amp, a)
+}
+
+func (q Quantizers) duration(d time.Duration) time.Duration {
+	if q.Dur == nil {
+		return d
+	}
+
+	return time.Duration(math.Round(q.Dur.Quantize(milliseconds(d)) * float64(time.Millisecond)))
+}
+
+// milliseconds returns d in milliseconds, fractions of a millisecond included.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (q Quantizers) panning(p float64) float64 {
+	return quantize(q.Pan, p)
+}
+
+// sine returns s with its frequency, amplitude and duration quantized.
+func (q Quantizers) sine(s Sine) Sine {
+	s.Frequency = q.frequency(s.Frequency)
+	s.Amplitude = q.amplitude(s.Amplitude)
+	s.Duration = q.duration(s.Duration)
+
+	return s
+}
+
+func quantize(q Quantizer, v float64) float64 {
+	if q == nil {
+		return v
+	}
+
+	return q.Quantize(v)
+}
+
+// Cents snaps frequencies to a grid of Step cents around Reference.
+type Cents struct {
+	// Step of the grid in cents, 100 being the equal tempered semitone.
+	Step float64
+	// Reference is a frequency on the grid. If not set 440 Hz is used.
+	Reference float64
+}
+
+// Quantize implements Quantizer.
+func (c Cents) Quantize(f float64) float64 {
+	if f <= 0 || c.Step <= 0 {
+		return f
+	}
+
+	reference := c.Reference
+	if reference == 0 {
+		reference = 440.
+	}
+
+	cents := 1200 * math.Log2(f/reference)
+
+	return reference * math.Exp2(math.Round(cents/c.Step)*c.Step/1200)
+}
+
+// Scale snaps frequencies to the nearest note of a scale repeating every octave.
+type Scale struct {
+	// Root is the frequency of the first degree of the scale.
+	Root float64
+	// Degrees are the notes of the scale in cents above Root, within an octave.
+	// For example the major scale is {0, 200, 400, 500, 700, 900, 1100}.
+	Degrees []float64
+}
+
+// Quantize implements Quantizer.
+func (s Scale) Quantize(f float64) float64 {
+	if f <= 0 || s.Root <= 0 || len(s.Degrees) == 0 {
+		return f
+	}
+
+	cents := 1200 * math.Log2(f/s.Root)
+	octave := math.Floor(cents / 1200)
+	within := cents - octave*1200
+
+	// The first degree of the next octave is a candidate too.
+	nearest := s.Degrees[0] + 1200
+	for _, degree := range s.Degrees {
+		if math.Abs(within-degree) < math.Abs(within-nearest) {
+			nearest = degree
+		}
+	}
+
+	return s.Root * math.Exp2(octave+nearest/1200)
+}
+
+// Decibels snaps amplitudes to steps of Step dB below full scale. Silence stays silent.
+type Decibels struct {
+	Step float64
+}
+
+// Quantize implements Quantizer.
+func (d Decibels) Quantize(a float64) float64 {
+	if a == 0 || d.Step <= 0 {
+		return a
+	}
+
+	db := 20 * math.Log10(math.Abs(a))
+
+	return math.Copysign(math.Pow(10, math.Round(db/d.Step)*d.Step/20), a)
+}
+
+// Rhythm snaps durations, in milliseconds, to multiples of Step. Nothing is shorter than a Step.
+type Rhythm struct {
+	Step time.Duration
+}
+
+// Quantize implements Quantizer.
+func (r Rhythm) Quantize(ms float64) float64 {
+	step := milliseconds(r.Step)
+	if step <= 0 {
+		return ms
+	}
+
+	return math.Max(math.Round(ms/step), 1) * step
+}
+
+// Sectors snaps panning to the middle of one of N equal sectors of the panning range.
+type Sectors struct {
+	N int
+}
+
+// Quantize implements Quantizer.
+func (s Sectors) Quantize(p float64) float64 {
+	if s.N < 1 {
+		return p
+	}
+
+	n := float64(s.N)
+	sector := math.Min(math.Max(math.Floor(p*n), 0), n-1)
+
+	return (sector + .5) / n
+}
@@ -0,0 +1,161 @@
+package markov
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuantizers(t *testing.T) {
+	a := assert.New(t)
+
+	semitones := Cents{Step: 100}
+	a.InDelta(440., semitones.Quantize(440.000001), 1e-9)
+	a.InDelta(440., semitones.Quantize(445.), 1e-9)
+	a.InDelta(466.1637615, semitones.Quantize(460.), 1e-6)
+	a.Equal(0., semitones.Quantize(0))
+
+	major := Scale{Root: 261.6255653, Degrees: []float64{0, 200, 400, 500, 700, 900, 1100}}
+	// C# snaps to C or D, F# to F or G, both in the scale.
+	for _, f := range []float64{277.18, 369.99, 1000., 60.} {
+		cents := 1200 * math.Log2(major.Quantize(f)/major.Root)
+		within := math.Mod(math.Round(cents)+1200*10, 1200)
+		a.Contains(major.Degrees, within, "%v", f)
+	}
+	// B snaps up to the C of the next octave.
+	a.InDelta(2*major.Root, major.Quantize(2*major.Root*0.985), 1e-9)
+
+	db := Decibels{Step: 6}
+	a.InDelta(math.Pow(10, -6./20), db.Quantize(.49), 1e-9)
+	a.InDelta(-math.Pow(10, -6./20), db.Quantize(-.49), 1e-9)
+	a.Equal(0., db.Quantize(0))
+
+	rhythm := Rhythm{Step: 50 * time.Millisecond}
+	a.Equal(100., rhythm.Quantize(110))
+	a.Equal(150., rhythm.Quantize(130))
+	a.Equal(50., rhythm.Quantize(5))
+
+	// Steps and durations keep their fractions of a millisecond.
+	rhythm = Rhythm{Step: 250 * time.Microsecond}
+	a.Equal(1.25, rhythm.Quantize(1.3))
+	a.Equal(1250*time.Microsecond, Quantizers{Dur: rhythm}.duration(1300*time.Microsecond))
+
+	identity := QuantizerFunc(func(v float64) float64 { return v })
+	a.Equal(20833*time.Nanosecond, Quantizers{Dur: identity}.duration(20833*time.Nanosecond))
+
+	sectors := Sectors{N: 4}
+	a.Equal(.125, sectors.Quantize(0))
+	a.Equal(.375, sectors.Quantize(.3))
+	a.Equal(.875, sectors.Quantize(1))
+
+	double := QuantizerFunc(func(v float64) float64 { return v * 2 })
+	a.Equal(4., double.Quantize(2))
+}
+
+func TestModelQuantizers(t *testing.T) {
+	a := assert.New(t)
+
+	train := []Sine{
+		{Frequency: 440., Amplitude: .5, Duration: 98 * time.Millisecond},
+		{Frequency: 440.000001, Amplitude: .49, Duration: 102 * time.Millisecond},
+		{Frequency: 446., Amplitude: .51, Duration: 100 * time.Millisecond},
+		{Frequency: 880.3, Amplitude: .26, Duration: 190 * time.Millisecond},
+	}
+
+	states := func(m Model) (freqs, amps, durs []string) {
+		for _, field := range []struct {
+			chain  Chain
+			states *[]string
+		}{{m.Freq, &freqs}, {m.Amp, &amps}, {m.Dur, &durs}} {
+			data, err := field.chain.MarshalJSON()
+			a.NoError(err)
+
+			var exported model
+			a.NoError(json.Unmarshal(data, &exported))
+
+			for k := range exported.SpoolMap.(map[string]any) {
+				if k != "^" && k != "$" {
+					*field.states = append(*field.states, k)
+				}
+			}
+		}
+
+		return
+	}
+
+	var plain Model
+	plain.Add(train)
+	freqs, amps, durs := states(plain)
+	a.Len(freqs, 4)
+	a.Len(amps, 4)
+	a.Len(durs, 4)
+
+	quantized := Model{Quantizers: Quantizers{
+		Freq: Cents{Step: 100},
+		Amp:  Decibels{Step: 6},
+		Dur:  Rhythm{Step: 50 * time.Millisecond},
+	}}
+	quantized.Add(train)
+	freqs, amps, durs = states(quantized)
+	a.ElementsMatch([]string{"440.000000", "880.000000"}, freqs)
+	a.Len(amps, 2)
+	a.ElementsMatch([]string{"100", "200"}, durs)
+}
+
+func TestNGenQuantizers(t *testing.T) {
+	a := assert.New(t)
+
+	var train []Sine
+	for i := 0; i < 16; i++ {
+		train = append(train, Sine{
+			Frequency: 220. + 37.*float64(i%5),
+			Amplitude: .1 + .07*float64(i%3),
+			Duration:  time.Duration(20+13*(i%4)) * time.Millisecond,
+		})
+	}
+
+	var m Model
+	m.Add(train)
+
+	seed := t.TempDir()
+	a.NoError(m.Export(seed))
+
+	s := Song{
+		NGenerations:  1,
+		FilePath:      t.TempDir(),
+		ModelsPath:    t.TempDir(),
+		SeedModelPath: seed,
+		Harmonics:     noHarmonics{},
+		Quantizers:    Quantizers{Freq: Cents{Step: 100}, Dur: Rhythm{Step: 25 * time.Millisecond}},
+	}
+	a.NoError(s.NGen())
+
+	// The generated sines were quantized before the next generation was trained on them.
+	data, err := os.ReadFile(filepath.Join(s.ModelsPath, "gen0", "dur.json"))
+	a.NoError(err)
+
+	var exported model
+	a.NoError(json.Unmarshal(data, &exported))
+
+	var onGrid int
+	for k := range exported.SpoolMap.(map[string]any) {
+		if strings.ContainsAny(k, "^$") {
+			continue
+		}
+
+		ms, err := strconv.Atoi(k)
+		a.NoError(err)
+		if ms%25 == 0 {
+			onGrid++
+		}
+	}
+
+	a.Positive(onGrid)
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/bh90210/mlsic"
 	"github.com/bh90210/mlsic/markov"
+	"github.com/bh90210/mlsic/master"
 	"github.com/bh90210/mlsic/render"
 	"github.com/go-audio/generator"
 	"github.com/mb-14/gomarkov"
@@ -19,6 +20,8 @@ func main() {
 	debug := flag.Bool("debug", false, "sets log level to debug")
 	filesPath := flag.String("files", "", "sets the directory audio files will be saved")
 	modelsPath := flag.String("models", "", "sets the directory model files will be saved")
+	sampleRate := flag.Int("rate", mlsic.SampleRate, "sets the sampling rate")
+	rollOff := flag.Float64("rolloff", 0, "sets the width in Hz of the band below the ceiling partials fade out in")
 
 	flag.Parse()
 
@@ -364,42 +367,45 @@ func main() {
 	var left []float64
 	// Right channel.
 	var right []float64
+
+	limit := mlsic.NewBandLimit(*sampleRate)
+	limit.RollOff = *rollOff
+
+	// The train is timed by the absolute time each tone starts at, so it does not drift.
+	var elapsed time.Duration
 	for _, v := range train {
-		osc := generator.NewOsc(generator.WaveSine, v.Frequency, 44100)
+		start := mlsic.DurationInSamples(elapsed, *sampleRate)
+		elapsed += v.Duration.Abs()
+		length := mlsic.DurationInSamples(elapsed, *sampleRate) - start
+
+		osc := generator.NewOsc(generator.WaveSine, v.Frequency, *sampleRate)
 		osc.Amplitude = v.Amplitude
 		// osc.SetAttackInMs(10)
 
-		signal := osc.Signal(44 * int(v.Duration.Abs().Milliseconds()))
+		signal := osc.Signal(length)
 
 		for partial, amplitude := range partials {
-			if v.Frequency*float64(partial) > 18000 {
+			gain := limit.Gain(v.Frequency * float64(partial))
+			if gain == 0 {
 				continue
 			}
 
-			osc = generator.NewOsc(generator.WaveSine, v.Frequency*float64(partial), 44100)
+			osc = generator.NewOsc(generator.WaveSine, v.Frequency*float64(partial), *sampleRate)
 
 			amplitude = amplitude + ((amplitude - partials[partial]) / 2)
 			if amplitude < 0 {
 				amplitude *= -1
 			}
 
-			osc.Amplitude = v.Amplitude * amplitude
+			osc.Amplitude = v.Amplitude * amplitude * gain
 			// osc.SetAttackInMs(10)
 
-			partialSignal := osc.Signal(44 * int(v.Duration.Abs().Milliseconds()))
+			partialSignal := osc.Signal(length)
 			for i := range signal {
 				signal[i] += partialSignal[i]
 			}
 		}
 
-		for i, s := range signal {
-			if s >= 1. {
-				signal[i] = 0.
-			} else if s <= -1. {
-				signal[i] = 0.
-			}
-		}
-
 		left = append(left, signal...)
 		right = append(right, signal...)
 	}
@@ -407,10 +413,11 @@ func main() {
 	var music []mlsic.Audio
 	music = append(music, mlsic.Audio(left), mlsic.Audio(right))
 
-	// Render audio as .wav files.
-	p := render.Wav{
-		Filepath: *filesPath,
-	}
+	// Render audio as .wav files, limiting the peaks instead of letting them clip.
+	p := master.New(&render.Wav{
+		Filepath:   *filesPath,
+		SampleRate: *sampleRate,
+	}, master.WithSampleRate(*sampleRate), master.WithLimiter(-1))
 
 	if err := p.Render(music, "seed"); err != nil {
 		log.Fatal().Err(err).Msg("rendering")
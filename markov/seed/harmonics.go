@@ -13,6 +13,13 @@ import (
 
 // PrimeHarmonics .
 type PrimeHarmonics struct {
+	// BandLimit leaves out the partials above its ceiling. Its roll-off band is
+	// applied when the voices are rendered, see markov.WithBandLimit.
+	// If not set mlsic.NewBandLimit of SampleRate is used.
+	BandLimit mlsic.BandLimit
+	// SampleRate the voices are rendered at. If not set mlsic.SampleRate is used.
+	SampleRate int
+
 	base []mlsic.Partial
 }
 
@@ -37,51 +44,26 @@ func (p *PrimeHarmonics) PartialsGen(voice markov.Voice) markov.Voice {
 
 	log.Debug().Any("p", p.base).Msg("yo")
 
-	for toneIndex, tone := range voice {
-		for _, partial := range p.base {
-			if partial.Number*int(tone.Fundamental.Frequency) > mlsic.MaxFrequency {
-				continue
-			}
-
-			var start time.Duration
-			var duration time.Duration
-
-			switch {
-			// The duration of the tone is shorter than when partial begins.
-			// Thus we skip this partial.
-			case partial.Start > tone.Fundamental.Duration:
-				continue
-
-			// If the total duration of the partial is longer than the fundamental
-			// then the partial needs to be shorter too.
-			case partial.Start+partial.Duration > tone.Fundamental.Duration:
-				start = partial.Start
-				duration = tone.Fundamental.Duration - partial.Start
-
-			default:
-				start = partial.Start
-				duration = partial.Duration
-			}
-
-			tone.Partials = append(tone.Partials, mlsic.Partial{
-				Number:          partial.Number,
-				AmplitudeFactor: partial.AmplitudeFactor,
-				Start:           start,
-				Duration:        duration,
-			})
+	limit := p.BandLimit
+	if limit == (mlsic.BandLimit{}) {
+		sampleRate := p.SampleRate
+		if sampleRate == 0 {
+			sampleRate = mlsic.SampleRate
 		}
 
-		voice[toneIndex] = tone
+		limit = mlsic.NewBandLimit(sampleRate)
 	}
 
-	return voice
+	return Partials(voice, p.base, limit)
 }
 
-// Partials .
-func Partials(voice markov.Voice, partials []mlsic.Partial) markov.Voice {
+// Partials adds partials to every tone of voice, leaving out those above the ceiling
+// of limit. Partials in the roll-off band keep their amplitude, the band limit fades
+// them out once, when the voice is rendered with it.
+func Partials(voice markov.Voice, partials []mlsic.Partial, limit mlsic.BandLimit) markov.Voice {
 	for toneIndex, tone := range voice {
 		for _, partial := range partials {
-			if partial.Number*int(tone.Fundamental.Frequency) > mlsic.MaxFrequency {
+			if float64(partial.Number)*tone.Fundamental.Frequency > limit.Ceiling {
 				continue
 			}
 
@@ -1,5 +1,67 @@
 package seed
 
+import (
+	"testing"
+	"time"
+
+	"github.com/bh90210/mlsic"
+	"github.com/bh90210/mlsic/markov"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimeHarmonics(t *testing.T) {
+	a := assert.New(t)
+
+	voice := func() markov.Voice {
+		return markov.Voice{0: markov.Tone{
+			Fundamental: markov.Sine{Frequency: 2000, Amplitude: 1, Duration: 300 * time.Millisecond},
+		}}
+	}
+
+	numbers := func(v markov.Voice) (n []int) {
+		for _, p := range v[0].Partials {
+			n = append(n, p.Number)
+		}
+
+		return
+	}
+
+	// At 16 kHz only the partials below 8 kHz are left.
+	h := PrimeHarmonics{SampleRate: 16000}
+	a.Equal([]int{2, 3}, numbers(h.PartialsGen(voice())))
+
+	// At the default sample rate up to mlsic.MaxFrequency.
+	h = PrimeHarmonics{}
+	a.Equal([]int{2, 3, 5, 7}, numbers(h.PartialsGen(voice())))
+
+	// Partials in the roll-off band keep their amplitude, the band limit
+	// fades them out when rendering, and those above the ceiling are left out.
+	limit := mlsic.BandLimit{Ceiling: 8000, RollOff: 4000}
+	v := Partials(voice(), []mlsic.Partial{
+		{Number: 2, AmplitudeFactor: .1, Duration: time.Millisecond},
+		{Number: 3, AmplitudeFactor: .1, Duration: time.Millisecond},
+		{Number: 5, AmplitudeFactor: .1, Duration: time.Millisecond},
+	}, limit)
+	a.Len(v[0].Partials, 2)
+	a.InDelta(.1, v[0].Partials[0].AmplitudeFactor, 1e-12)
+	a.InDelta(.1, v[0].Partials[1].AmplitudeFactor, 1e-12)
+
+	// Rendered with the band limit the partial in the middle of the band sounds at half its amplitude, once.
+	tone := v[0]
+	tone.Partials = tone.Partials[1:]
+
+	want, err := markov.Deconstruct([]markov.Voice{{0: {Fundamental: tone.Fundamental}}}, mlsic.Mono(), markov.WithBandLimit(limit))
+	a.NoError(err)
+
+	got, err := markov.Deconstruct([]markov.Voice{{0: tone}}, mlsic.Mono(), markov.WithBandLimit(limit))
+	a.NoError(err)
+
+	_, _, partial := tone.PartialSignal(tone.Partials[0], mlsic.SampleRate)
+	for i := range partial {
+		a.InDelta(want[0][i]+partial[i]*.1*.5, got[0][i], 1e-12)
+	}
+}
+
 // func TestPartials(t *testing.T) {
 // 	var poly []markov.Voice
 
@@ -16,6 +16,12 @@ import (
 	"github.com/mb-14/gomarkov"
 )
 
+// sampleRate the seed is rendered at.
+var sampleRate = flag.Int("rate", mlsic.SampleRate, "sets the sampling rate")
+
+// rollOff is the width in Hz of the band below the ceiling partials fade out in.
+var rollOff = flag.Float64("rolloff", 0, "sets the width in Hz of the band below the ceiling partials fade out in")
+
 func main() {
 	debug := flag.Bool("debug", false, "sets log level to debug")
 	filesPath := flag.String("files", "", "sets the directory audio files will be saved")
@@ -39,7 +45,7 @@ func main() {
 	poly := polySeed()
 
 	// Add the data to the model.
-	m.AddPoly(poly)
+	m.AddPoly(poly, *sampleRate)
 
 	// Save seed model.
 	err := m.Export(*modelsPath)
@@ -47,10 +53,10 @@ func main() {
 		log.Fatal().Err(err).Msg("exporting model")
 	}
 
-	noOfSpeakers := mlsic.TwoSpeakers
+	layout := mlsic.Stereo()
 
 	// Generate the audio signal.
-	speakers, err := markov.Deconstruct(poly, noOfSpeakers)
+	speakers, err := markov.Deconstruct(poly, layout, markov.WithSampleRate(*sampleRate), markov.WithBandLimit(bandLimit()))
 	if err != nil {
 		log.Fatal().Err(err).Msg("deconstructing trains")
 	}
@@ -59,16 +65,23 @@ func main() {
 	music = append(music, speakers...)
 
 	// Render audio to Port Audio.
-	p, _ := render.NewPortAudio(render.WithChannels(noOfSpeakers))
+	p, err := render.NewPortAudio(render.WithChannels(layout.Len()), render.WithSampleRate(*sampleRate))
+	if err != nil {
+		log.Fatal().Err(err).Msg("initializing port audio")
+	}
+
 	fmt.Println(*filesPath)
 
 	if err := p.Render(music, "seed"); err != nil {
 		log.Fatal().Err(err).Msg("rendering port audio")
 	}
 
+	p.Close()
+
 	// Render audio as .wav files.
 	pp := render.Wav{
-		Filepath: *filesPath,
+		Filepath:   *filesPath,
+		SampleRate: *sampleRate,
 	}
 
 	if err := pp.Render(music, "seed"); err != nil {
@@ -76,6 +89,19 @@ func main() {
 	}
 }
 
+// bandLimit returns the band limit of the seed's partials.
+func bandLimit() mlsic.BandLimit {
+	limit := mlsic.NewBandLimit(*sampleRate)
+	limit.RollOff = *rollOff
+
+	return limit
+}
+
+// after returns the time the tone of voice starting at at ends, at itself if none does.
+func after(voice markov.Voice, at time.Duration) time.Duration {
+	return at + voice[mlsic.DurationInSamples(at, *sampleRate)].Fundamental.Duration
+}
+
 // polySeed .
 func polySeed() []markov.Voice {
 	log.Info().Msg("melody train")
@@ -88,7 +114,7 @@ func polySeed() []markov.Voice {
 	voice4 := make(markov.Voice)
 
 	// Move 1.
-	var toneIndex int
+	var toneIndex time.Duration
 	// toneIndex = upDown(80., .5, toneIndex, voice1, 0.1, 5000)
 
 	// upDown(90., .6, toneIndex, voice1, 0.1, 1000)
@@ -112,7 +138,10 @@ func polySeed() []markov.Voice {
 	// Move 4.
 	move4(toneIndex, voice1, voice2, voice3, voice4)
 
-	var h seed.PrimeHarmonics
+	h := seed.PrimeHarmonics{
+		BandLimit:  bandLimit(),
+		SampleRate: *sampleRate,
+	}
 	h.PartialsGen(voice1)
 	h.PartialsGen(voice2)
 	h.PartialsGen(voice3)
@@ -124,31 +153,31 @@ func polySeed() []markov.Voice {
 	return poly
 }
 
-func upDown(freq float64, pan float64, tone int, voice markov.Voice, factor float64, duration int) int {
+func upDown(freq float64, pan float64, tone time.Duration, voice markov.Voice, factor float64, duration int) time.Duration {
 	for i := 0.; i < 1.; i += factor {
-		tone += voice[tone].Fundamental.DurationInSamples()
+		tone = after(voice, tone)
 
-		voice[tone] = markov.Tone{
+		voice.Place(tone, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: i / 8,
 				Duration:  time.Duration(duration) * time.Millisecond,
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	for i := 1.; i > 0.; i -= 0.1 {
-		tone += voice[tone].Fundamental.DurationInSamples()
+		tone = after(voice, tone)
 
-		voice[tone] = markov.Tone{
+		voice.Place(tone, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: i / 8,
 				Duration:  time.Duration(5 * time.Millisecond),
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	return tone
@@ -218,7 +247,7 @@ var primeMove1 = []mlsic.Partial{
 	},
 }
 
-func move3(toneIndex int, voices ...markov.Voice) []markov.Voice {
+func move3(toneIndex time.Duration, voices ...markov.Voice) []markov.Voice {
 	var freq float64 = 440.
 	var pan float64 = .0
 	var duration int = 5
@@ -240,9 +269,7 @@ func move3(toneIndex int, voices ...markov.Voice) []markov.Voice {
 	}
 
 	for _, v := range voices {
-		if v.LengthInSamples() > toneIndex {
-			toneIndex = v.LengthInSamples()
-		}
+		toneIndex = max(toneIndex, v.End(*sampleRate))
 	}
 
 	freq = 4440.
@@ -269,9 +296,7 @@ func move3(toneIndex int, voices ...markov.Voice) []markov.Voice {
 	}
 
 	for _, v := range voices {
-		if v.LengthInSamples() > toneIndex {
-			toneIndex = v.LengthInSamples()
-		}
+		toneIndex = max(toneIndex, v.End(*sampleRate))
 	}
 
 	duration = 10
@@ -345,48 +370,48 @@ func move3(toneIndex int, voices ...markov.Voice) []markov.Voice {
 	return voices
 }
 
-func move3UpDown(freq float64, pan float64, tone int, voice markov.Voice, factor1, factor2 float64, duration int) int {
+func move3UpDown(freq float64, pan float64, tone time.Duration, voice markov.Voice, factor1, factor2 float64, duration int) time.Duration {
 	for i := 0.; i < 1.; i += factor1 {
-		tone += voice[tone].Fundamental.DurationInSamples()
+		tone = after(voice, tone)
 
-		voice[tone] = markov.Tone{
+		voice.Place(tone, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: i / 8,
 				Duration:  time.Duration(duration) * time.Millisecond,
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	for i := 1.; i > 0.; i -= factor2 {
-		tone += voice[tone].Fundamental.DurationInSamples()
+		tone = after(voice, tone)
 
-		voice[tone] = markov.Tone{
+		voice.Place(tone, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: i / 8,
 				Duration:  time.Duration(5 * time.Millisecond),
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	return tone
 }
 
-func move4(toneIndex int, voices ...markov.Voice) []markov.Voice {
+func move4(toneIndex time.Duration, voices ...markov.Voice) []markov.Voice {
 	for _, voice := range voices {
-		toneIndex += voice[toneIndex].Fundamental.DurationInSamples()
+		toneIndex = after(voice, toneIndex)
 
-		voice[toneIndex] = markov.Tone{
+		voice.Place(toneIndex, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: 1000,
 				Amplitude: .2 / 8,
 				Duration:  time.Duration(1000) * time.Millisecond,
 			},
 			Panning: 0.5,
-		}
+		}, *sampleRate)
 	}
 
 	for voiceIndex, voice := range voices {
@@ -407,16 +432,16 @@ func move4(toneIndex int, voices ...markov.Voice) []markov.Voice {
 
 		}
 
-		toneIndex += voice[toneIndex].Fundamental.DurationInSamples()
+		toneIndex = after(voice, toneIndex)
 
-		voice[toneIndex] = markov.Tone{
+		voice.Place(toneIndex, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: .2 / 8,
 				Duration:  time.Duration(1000) * time.Millisecond,
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	for voiceIndex, voice := range voices {
@@ -441,16 +466,16 @@ func move4(toneIndex int, voices ...markov.Voice) []markov.Voice {
 
 		}
 
-		toneIndex += voice[toneIndex].Fundamental.DurationInSamples()
+		toneIndex = after(voice, toneIndex)
 
-		voice[toneIndex] = markov.Tone{
+		voice.Place(toneIndex, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: .2 / 8,
 				Duration:  time.Duration(1000) * time.Millisecond,
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	for voiceIndex, voice := range voices {
@@ -475,16 +500,16 @@ func move4(toneIndex int, voices ...markov.Voice) []markov.Voice {
 
 		}
 
-		toneIndex += voice[toneIndex].Fundamental.DurationInSamples()
+		toneIndex = after(voice, toneIndex)
 
-		voice[toneIndex] = markov.Tone{
+		voice.Place(toneIndex, markov.Tone{
 			Fundamental: markov.Sine{
 				Frequency: freq,
 				Amplitude: .2 / 8,
 				Duration:  time.Duration(1000) * time.Millisecond,
 			},
 			Panning: pan,
-		}
+		}, *sampleRate)
 	}
 
 	return voices
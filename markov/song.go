@@ -2,17 +2,20 @@ package markov
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/bh90210/mlsic"
-	"github.com/mb-14/gomarkov"
+	"github.com/bh90210/mlsic/master"
+	"github.com/bh90210/mlsic/render"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -27,11 +30,37 @@ type Song struct {
 	ModelsPath string
 	// SeedModelPath is the path of the initial seed jsons.
 	SeedModelPath string
+	// SampleRate of the generated audio. If not set mlsic.SampleRate is used.
+	SampleRate int
+	// Mode is how the seed model and the generations model the sines.
+	// The seed model must have been trained in the same mode.
+	Mode Mode
+	// Quantizers snap the generated sines and the states of the
+	// generations to grids. The seed model is read as it is.
+	Quantizers Quantizers
 
 	// Harmonics is the harmonics structure that will be used for audio generation.
 	Harmonics mlsic.Harmonics
+	// BandLimit band-limits the partials and waveforms of the generated audio.
+	// If not set mlsic.NewBandLimit of the sample rate is used.
+	BandLimit mlsic.BandLimit
+
+	// Layout the voices of PolyGen are deconstructed to. If not set mlsic.Stereo is used.
+	Layout mlsic.Layout
+	// MaxEvents is the maximum number of events of a PolyGen generation.
+	// If not set DefaultMaxEvents is used.
+	MaxEvents int
+
+	// Mastering are the options of the mastering stage the generated audio is rendered
+	// through. If nil peaks are limited to -1 dBFS, if empty the audio is rendered as it is.
+	Mastering []master.Option
+	// Reports holds the mastering report of every generation of the last NGen or PolyGen.
+	Reports []master.Report
 }
 
+// DefaultMaxEvents is the maximum number of events of a PolyGen generation if Song.MaxEvents is not set.
+const DefaultMaxEvents = 1000
+
 type model struct {
 	Int      int `json:"int"`
 	SpoolMap any `json:"spool_map"`
@@ -39,249 +68,553 @@ type model struct {
 }
 
 // NGen will process the seed model and based on it will generate the appropriate amount of generation cycles.
-func (s *Song) NGen() {
+// It stops at the first generation that fails and returns the error.
+func (s *Song) NGen() error {
 	log.Info().Msg("NGen")
 
+	sampleRate := s.SampleRate
+	if sampleRate == 0 {
+		sampleRate = mlsic.SampleRate
+	}
+
+	s.Reports = nil
+
 	// Generate a new model and audio output for each generation.
 	for i := 0; i < s.NGenerations; i++ {
 		log.Logger = log.With().Int("gen", i).Logger()
 
 		log.Info().Msg("NGen")
 
-		var freqModel string
-		var ampModel string
-		var durModel string
-
 		index := strconv.Itoa(i)
 
 		// If we are on the first iteration we must start by reading
 		// the seed model.
-		if i == 0 {
-			freqModel = filepath.Join(s.SeedModelPath, "freq.json")
-			ampModel = filepath.Join(s.SeedModelPath, "amp.json")
-			durModel = filepath.Join(s.SeedModelPath, "dur.json")
+		modelPath := s.SeedModelPath
+		// If the seed model is already processed read the previously generated model.
+		if i > 0 {
+			modelPath = filepath.Join(s.ModelsPath, "gen"+strconv.Itoa(i-1))
+		}
 
-			// If the seed model is already processed read the previously generated model.
-		} else {
-			previousModelsIndex := strconv.Itoa(i - 1)
+		t, err := s.load(modelPath)
+		if err != nil {
+			return err
+		}
+
+		var train []Sine
 
-			freqModel = filepath.Join(s.ModelsPath, "gen"+previousModelsIndex, "freq.json")
-			ampModel = filepath.Join(s.ModelsPath, "gen"+previousModelsIndex, "amp.json")
-			durModel = filepath.Join(s.ModelsPath, "gen"+previousModelsIndex, "dur.json")
+		switch s.Mode {
+		case Joint:
+			train, err = jointTrain(t)
+
+		case Factored:
+			train, err = factoredTrain(t)
+
+		default:
+			train, err = independentTrain(t)
 		}
 
-		log.Info().Msg("reading files")
+		if err != nil {
+			return err
+		}
+
+		for i := range train {
+			train[i] = t.Quantizers.sine(train[i])
+		}
+
+		// Reset logger to remove "field".
+		log.Logger = log.With().Reset().Logger().With().Int("gen", i).Logger()
 
-		freq, err := os.ReadFile(freqModel)
+		log.Info().Msg("audio files gen")
+
+		// filePath := filepath.Join(s.FilePath, "gen"+index)
+
+		err = os.MkdirAll(s.FilePath, 0755)
 		if err != nil {
-			log.Fatal().Err(err).Msg("reading freq")
+			return fmt.Errorf("creating audio directory: %w", err)
 		}
 
-		amp, err := os.ReadFile(ampModel)
+		// Generate audio based on the new model.
+		report, err := Generate(s.FilePath, train, s.Harmonics, i, sampleRate,
+			WithTrainBandLimit(s.BandLimit), WithMastering(s.mastering()...))
 		if err != nil {
-			log.Fatal().Err(err).Msg("reading amp")
+			return fmt.Errorf("generating audio: %w", err)
 		}
 
-		dur, err := os.ReadFile(durModel)
+		s.Reports = append(s.Reports, report)
+
+		log.Info().Msg("export models")
+
+		// Save the new model.
+		t.Add(train)
+
+		modelsPath := filepath.Join(s.ModelsPath, "gen"+index)
+
+		err = os.MkdirAll(modelsPath, 0755)
+		if err != nil {
+			return fmt.Errorf("creating models directory: %w", err)
+		}
+
+		err = t.Export(modelsPath)
 		if err != nil {
-			log.Fatal().Err(err).Msg("reading dur")
+			return fmt.Errorf("exporting models: %w", err)
 		}
+	}
+
+	return nil
+}
+
+// mastering returns the options of the mastering stage of the song.
+func (s *Song) mastering() []master.Option {
+	if s.Mastering == nil {
+		return defaultMastering()
+	}
 
-		log.Info().Msg("creating chains")
+	return s.Mastering
+}
+
+// PolyGen is the polyphonic counterpart of NGen. It samples voices out of the seed
+// Poly model, deconstructs them to a polygen{n}.wav file per speaker and trains the
+// model of the next generation on them. It stops at the first generation that fails
+// and returns the error.
+func (s *Song) PolyGen() error {
+	log.Info().Msg("PolyGen")
+
+	sampleRate := s.SampleRate
+	if sampleRate == 0 {
+		sampleRate = mlsic.SampleRate
+	}
+
+	layout := s.Layout
+	if layout.Len() == 0 {
+		layout = mlsic.Stereo()
+	}
 
-		// Prepare a Markov Train so we can load the previously created model.
-		t := Model{
-			Freq: gomarkov.NewChain(1),
-			Amp:  gomarkov.NewChain(1),
-			Dur:  gomarkov.NewChain(1),
+	maxEvents := s.MaxEvents
+	if maxEvents == 0 {
+		maxEvents = DefaultMaxEvents
+	}
+
+	s.Reports = nil
+
+	for i := 0; i < s.NGenerations; i++ {
+		l := log.With().Int("gen", i).Logger()
+
+		l.Info().Msg("PolyGen")
+
+		modelPath := s.SeedModelPath
+		if i > 0 {
+			modelPath = filepath.Join(s.ModelsPath, "gen"+strconv.Itoa(i-1))
+		}
+
+		poly, err := readChain(modelPath, "poly")
+		if err != nil {
+			return err
+		}
+
+		t := &Model{Poly: poly, Quantizers: s.Quantizers}
+
+		voices, err := t.GeneratePoly(rand.New(rand.NewSource(int64(420))), maxEvents, sampleRate)
+		if err != nil {
+			return fmt.Errorf("generating voices: %w", err)
+		}
+
+		l.Info().Int("voices", len(voices)).Msg("audio files gen")
+
+		speakers, err := Deconstruct(voices, layout, WithSampleRate(sampleRate), WithBandLimit(s.BandLimit))
+		if err != nil {
+			return fmt.Errorf("deconstructing voices: %w", err)
 		}
 
-		// Load previously generated model.
-		t.Freq.UnmarshalJSON(freq)
-		t.Amp.UnmarshalJSON(amp)
-		t.Dur.UnmarshalJSON(dur)
+		err = os.MkdirAll(s.FilePath, 0755)
+		if err != nil {
+			return fmt.Errorf("creating audio directory: %w", err)
+		}
 
-		var wg sync.WaitGroup
+		w := master.New(&render.Wav{
+			Filepath:   s.FilePath,
+			SampleRate: sampleRate,
+		}, append([]master.Option{master.WithSampleRate(sampleRate)}, s.mastering()...)...)
 
-		var generationFreqs [][]float64
-		var generationAmps [][]float64
-		var generationDurs [][]float64
+		if err := w.Render(speakers, fmt.Sprintf("polygen%v", i)); err != nil {
+			return fmt.Errorf("rendering audio: %w", err)
+		}
 
-		for i := 0; i < 3; i++ {
-			wg.Add(1)
+		s.Reports = append(s.Reports, w.Report())
 
-			go func(i int) {
-				defer wg.Done()
+		l.Info().Msg("export models")
 
-				switch i {
-				case 0:
-					l := log.Logger
-					l = l.With().Str("field", "freq").Logger()
+		t.AddPoly(voices, sampleRate)
 
-					// Generate new values for frequencies, amplitudes and durations based on previous model.
-					var frequencies model
-					err = json.Unmarshal(freq, &frequencies)
-					if err != nil {
-						l.Fatal().Err(err).Msg("unmarsh freq")
-					}
+		modelsPath := filepath.Join(s.ModelsPath, "gen"+strconv.Itoa(i))
 
-					l.Info().Msg("entering loop")
+		err = os.MkdirAll(modelsPath, 0755)
+		if err != nil {
+			return fmt.Errorf("creating models directory: %w", err)
+		}
 
-					generationFreqs, err = markovGenerator(l, frequencies.SpoolMap, t.Freq)
-					if err != nil {
-						l.Fatal().Err(err).Msg("freq loop")
-					}
+		err = t.Export(modelsPath)
+		if err != nil {
+			return fmt.Errorf("exporting models: %w", err)
+		}
+	}
 
-				case 1:
-					l := log.Logger
-					l = l.With().Str("field", "amp").Logger()
+	return nil
+}
 
-					var amplitudes model
-					err = json.Unmarshal(amp, &amplitudes)
-					if err != nil {
-						l.Fatal().Err(err).Msg("unmarsh amp")
-					}
+// load reads the model of the mode of the song exported in path. Every
+// chain is loaded with the order it was exported with.
+func (s *Song) load(path string) (*Model, error) {
+	log.Info().Msg("reading files")
 
-					l.Info().Msg("entering loop")
+	t := &Model{Mode: s.Mode, Quantizers: s.Quantizers}
 
-					generationAmps, err = markovGenerator(l, amplitudes.SpoolMap, t.Amp)
-					if err != nil {
-						l.Fatal().Err(err).Msg("amp loop")
-					}
+	var err error
+	switch s.Mode {
+	case Joint:
+		t.Joint, err = readChain(path, "joint")
 
-				case 2:
-					l := log.Logger
-					l = l.With().Str("field", "dur").Logger()
+	case Factored:
+		t.Freq, err = readChain(path, "freq")
+		if err != nil {
+			return nil, err
+		}
 
-					var durations model
-					err = json.Unmarshal(dur, &durations)
-					if err != nil {
-						l.Fatal().Err(err).Msg("unmarsh dur")
-					}
+		t.AmpGivenFreq, err = readConditional(path, "amp_freq")
+		if err != nil {
+			return nil, err
+		}
 
-					l.Info().Msg("entering loop")
+		t.DurGivenFreq, err = readConditional(path, "dur_freq")
 
-					generationDurs, err = markovGenerator(l, durations.SpoolMap, t.Dur, true)
-					if err != nil {
-						l.Fatal().Err(err).Msg("dur loop")
-					}
+	default:
+		t.Freq, err = readChain(path, "freq")
+		if err != nil {
+			return nil, err
+		}
 
-				}
-			}(i)
+		t.Amp, err = readChain(path, "amp")
+		if err != nil {
+			return nil, err
 		}
 
-		wg.Wait()
+		t.Dur, err = readChain(path, "dur")
+	}
 
-		// Reset logger to remove "field".
-		log.Logger = log.With().Reset().Logger().With().Int("gen", i).Logger()
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
 
-		log.Info().Msg("creating sines train")
+// readChain loads the chain name exported in path.
+func readChain(path, name string) (Chain, error) {
+	data, err := os.ReadFile(filepath.Join(path, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
 
-		// Create sines train.
-		var train []Sine
+	chain, err := loadChain(data)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s model: %w", name, err)
+	}
+
+	return chain, nil
+}
 
-		for i, freqs := range generationFreqs {
-			var outOfBoundsAmp bool
-			var outOfBoundsDur bool
+// readConditional loads the conditional distribution name exported in path.
+func readConditional(path, name string) (*Conditional, error) {
+	data, err := os.ReadFile(filepath.Join(path, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", name, err)
+	}
+
+	conditional := NewConditional()
+	if err := json.Unmarshal(data, conditional); err != nil {
+		return nil, fmt.Errorf("loading %s model: %w", name, err)
+	}
+
+	return conditional, nil
+}
+
+// independentTrain generates frequencies, amplitudes and durations out of their own
+// chains and zips them together.
+func independentTrain(t *Model) ([]Sine, error) {
+	var wg sync.WaitGroup
 
-			if len(generationAmps)-1 < i {
-				outOfBoundsAmp = true
+	// Each field reports its own error.
+	errs := make([]error, 3)
+
+	var generationFreqs [][]float64
+	var generationAmps [][]float64
+	var generationDurs [][]float64
+
+	for i, field := range []struct {
+		name       string
+		chain      Chain
+		generation *[][]float64
+	}{
+		{"freq", t.Freq, &generationFreqs},
+		{"amp", t.Amp, &generationAmps},
+		{"dur", t.Dur, &generationDurs},
+	} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			l := log.Logger
+			l = l.With().Str("field", field.name).Logger()
+
+			l.Info().Msg("entering loop")
+
+			// Generate new values for frequencies, amplitudes and durations based on previous model.
+			generation, err := markovGenerator(l, field.chain)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s loop: %w", field.name, err)
+				return
 			}
 
-			if len(generationDurs)-1 < i {
-				outOfBoundsDur = true
+			*field.generation, err = parseTrains(generation)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s loop: %w", field.name, err)
 			}
+		}()
+	}
 
-			for o, freq := range freqs {
-				// TODO: 0 is arbitrary, fix it.
-				amp := 0.
-				if !outOfBoundsAmp && !(len(generationAmps[i])-1 < o) {
-					amp = generationAmps[i][o]
-				}
+	wg.Wait()
 
-				// TODO: 10 is arbitrary, fix it.
-				dur := 10.
-				if !outOfBoundsDur && !(len(generationDurs[i])-1 < o) {
-					dur = generationDurs[i][o]
-				}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	log.Info().Msg("creating sines train")
+
+	// Create sines train.
+	var train []Sine
+
+	for i, freqs := range generationFreqs {
+		var outOfBoundsAmp bool
+		var outOfBoundsDur bool
+
+		if len(generationAmps)-1 < i {
+			outOfBoundsAmp = true
+		}
+
+		if len(generationDurs)-1 < i {
+			outOfBoundsDur = true
+		}
+
+		for o, freq := range freqs {
+			// TODO: 0 is arbitrary, fix it.
+			amp := 0.
+			if !outOfBoundsAmp && !(len(generationAmps[i])-1 < o) {
+				amp = generationAmps[i][o]
+			}
 
-				train = append(train, Sine{
-					Frequency: freq,
-					Amplitude: amp,
-					Duration:  time.Duration(dur) * time.Millisecond,
-				})
+			// TODO: 10 is arbitrary, fix it.
+			dur := 10.
+			if !outOfBoundsDur && !(len(generationDurs[i])-1 < o) {
+				dur = generationDurs[i][o]
 			}
+
+			train = append(train, Sine{
+				Frequency: freq,
+				Amplitude: amp,
+				Duration:  time.Duration(dur) * time.Millisecond,
+			})
 		}
+	}
 
-		log.Info().Msg("audio files gen")
+	return train, nil
+}
 
-		// filePath := filepath.Join(s.FilePath, "gen"+index)
+// jointTrain generates (frequency, amplitude, duration) tuples out of the joint chain.
+func jointTrain(t *Model) ([]Sine, error) {
+	l := log.Logger.With().Str("field", "joint").Logger()
 
-		err = os.MkdirAll(s.FilePath, 0755)
-		if err != nil {
-			log.Fatal().Err(err).Msg("creating audio directory")
+	l.Info().Msg("entering loop")
+
+	generation, err := markovGenerator(l, t.Joint)
+	if err != nil {
+		return nil, fmt.Errorf("joint loop: %w", err)
+	}
+
+	log.Info().Msg("creating sines train")
+
+	var train []Sine
+	for _, tuples := range generation {
+		for _, tuple := range tuples {
+			sine, err := parseTuple(tuple)
+			if err != nil {
+				return nil, fmt.Errorf("joint loop: %w", err)
+			}
+
+			train = append(train, sine)
 		}
+	}
 
-		// Generate audio based on the new model.
-		Generate(s.FilePath, train, s.Harmonics, i)
+	return train, nil
+}
 
-		log.Info().Msg("export models")
+// factoredTrain generates frequencies out of the frequency chain and draws
+// the amplitude and the duration of each from their distribution given it.
+func factoredTrain(t *Model) ([]Sine, error) {
+	l := log.Logger.With().Str("field", "freq").Logger()
 
-		// Save the new model.
-		t.Add(train)
+	l.Info().Msg("entering loop")
 
-		modelsPath := filepath.Join(s.ModelsPath, "gen"+index)
+	generation, err := markovGenerator(l, t.Freq)
+	if err != nil {
+		return nil, fmt.Errorf("freq loop: %w", err)
+	}
 
-		err = os.MkdirAll(modelsPath, 0755)
-		if err != nil {
-			log.Fatal().Err(err).Msg("creating models directory")
+	log.Info().Msg("creating sines train")
+
+	prng := rand.New(rand.NewSource(int64(420)))
+
+	var train []Sine
+	for _, freqs := range generation {
+		for _, freq := range freqs {
+			amp, err := t.AmpGivenFreq.Generate(freq, prng)
+			if err != nil {
+				return nil, fmt.Errorf("amp given freq: %w", err)
+			}
+
+			dur, err := t.DurGivenFreq.Generate(freq, prng)
+			if err != nil {
+				return nil, fmt.Errorf("dur given freq: %w", err)
+			}
+
+			sine, err := parseTuple(strings.Join([]string{freq, amp, dur}, " "))
+			if err != nil {
+				return nil, err
+			}
+
+			train = append(train, sine)
 		}
+	}
 
-		err = t.Export(modelsPath)
+	return train, nil
+}
+
+// parseTrains parses the generated states of trains to floats.
+func parseTrains(trains [][]string) ([][]float64, error) {
+	parsed := make([][]float64, len(trains))
+	for i, train := range trains {
+		for _, v := range train {
+			flo, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing string to float: %w", err)
+			}
+
+			parsed[i] = append(parsed[i], flo)
+		}
+	}
+
+	return parsed, nil
+}
+
+// parseTuple parses a (frequency, amplitude, duration) state to a Sine.
+func parseTuple(tuple string) (Sine, error) {
+	values, err := parseState(tuple)
+	if err != nil {
+		return Sine{}, err
+	}
+
+	if len(values) != 3 {
+		return Sine{}, fmt.Errorf("%w: %q", ErrTuple, tuple)
+	}
+
+	return Sine{
+		Frequency: values[0],
+		Amplitude: values[1],
+		Duration:  time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+// parseState parses the space separated floats of a state.
+func parseState(st string) ([]float64, error) {
+	var values []float64
+	for _, v := range strings.Fields(st) {
+		flo, err := strconv.ParseFloat(v, 64)
 		if err != nil {
-			log.Fatal().Err(err).Msg("exporting seed")
+			return nil, fmt.Errorf("parsing string to float: %w", err)
 		}
+
+		values = append(values, flo)
 	}
+
+	return values, nil
 }
 
 // TODO: better name.
-func markovGenerator(l zerolog.Logger, spoolMap any, chain *gomarkov.Chain, dur ...bool) ([][]float64, error) {
-	mapped := spoolMap.(map[string]interface{})
+// markovGenerator generates a train of states out of every state of chain,
+// an n-gram of as many values as its order.
+func markovGenerator(l zerolog.Logger, chain Chain) ([][]string, error) {
+	data, err := chain.MarshalJSON()
+	if err != nil {
+		return nil, fmt.Errorf("marshal chain: %w", err)
+	}
+
+	var m model
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("unmarshal chain: %w", err)
+	}
+
+	mapped := m.SpoolMap.(map[string]interface{})
 
-	// Sort mapped.
-	var sortedMapped []float64
+	order := max(m.Int, 1)
+
+	// The states of the chain are its keys of order values, the
+	// rest of the keys are the values the states move to.
+	var states []state
 	for k := range mapped {
-		if k == "$" || k == "^" || k == "+Inf" {
+		ngram := strings.Split(k, "_")
+		if len(ngram) != order {
 			continue
 		}
 
-		flo, err := strconv.ParseFloat(k, 64)
-		if err != nil {
-			return nil, fmt.Errorf("parse float %w", err)
+		st := state{ngram: ngram}
+
+		valid := true
+		for _, v := range ngram {
+			if v == "$" || v == "^" || strings.Contains(v, "Inf") {
+				valid = false
+				break
+			}
+
+			values, err := parseState(v)
+			if err != nil {
+				return nil, fmt.Errorf("parse float %w", err)
+			}
+
+			st.values = append(st.values, values...)
 		}
 
-		sortedMapped = append(sortedMapped, flo)
+		if valid {
+			states = append(states, st)
+		}
 	}
 
-	slices.Sort(sortedMapped)
+	// Sort states.
+	slices.SortFunc(states, func(a, b state) int {
+		return slices.Compare(a.values, b.values)
+	})
 
-	var mu sync.Mutex
 	var wg sync.WaitGroup
 
-	temporaryTrain := make([][]float64, len(sortedMapped))
-	wg.Add(len(sortedMapped))
+	temporaryTrain := make([][]string, len(states))
+	errs := make([]error, len(states))
+	wg.Add(len(states))
 
-	for o, value := range sortedMapped {
-		go func(o int, value float64) {
+	for o, st := range states {
+		go func(o int, st state) {
 			defer wg.Done()
 
-			starting := []string{fmt.Sprintf("%f", value)}
-
-			if len(dur) > 0 {
-				starting = []string{fmt.Sprintf("%.0f", value)}
-			}
+			starting := st.ngram
 
-			var temp []float64
+			var temp []string
 			for i := 0; ; i++ {
 				l := l.With().
 					Int("outer iter", o).
@@ -291,7 +624,8 @@ func markovGenerator(l zerolog.Logger, spoolMap any, chain *gomarkov.Chain, dur
 				// generated, err := chain.GenerateDeterministic(starting, rand.New(rand.NewSource(int64(o))))
 				generated, err := chain.GenerateDeterministic(starting, rand.New(rand.NewSource(int64(420))))
 				if err != nil {
-					l.Fatal().Err(err).Msg("generating next markov")
+					errs[o] = fmt.Errorf("generating next markov: %w", err)
+					return
 				}
 
 				if generated == "$" {
@@ -299,13 +633,8 @@ func markovGenerator(l zerolog.Logger, spoolMap any, chain *gomarkov.Chain, dur
 					break
 				}
 
-				flo, err := strconv.ParseFloat(generated, 64)
-				if err != nil {
-					l.Fatal().Err(err).Msg("parsing string to float")
-				}
-
 				// Check is we are looping.
-				foundPattern := patternFinder(temp, flo)
+				foundPattern := patternFinder(temp, generated)
 				if foundPattern {
 					l.Debug().
 						Str("generated", generated).
@@ -313,25 +642,32 @@ func markovGenerator(l zerolog.Logger, spoolMap any, chain *gomarkov.Chain, dur
 					break
 				}
 
-				temp = append(temp, flo)
+				temp = append(temp, generated)
 
-				starting = []string{generated}
+				starting = append(slices.Clone(starting[1:]), generated)
 			}
 
-			mu.Lock()
 			temporaryTrain[o] = temp
-			mu.Unlock()
-
-		}(o, value)
+		}(o, st)
 	}
 
 	wg.Wait()
 
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
 	return temporaryTrain, nil
 }
 
-func patternFinder(temp []float64, flo float64) bool {
-	temp = append(temp, flo)
+// state is a state of a chain, the n-gram of the values leading to it.
+type state struct {
+	ngram  []string
+	values []float64
+}
+
+func patternFinder[T comparable](temp []T, v T) bool {
+	temp = append(temp, v)
 
 	if len(temp) < 10 {
 		return false
@@ -0,0 +1,231 @@
+package markov
+
+import (
+	"math"
+	"sync"
+
+	"github.com/bh90210/mlsic"
+)
+
+// Waveform is the shape of the cycle of an oscillator.
+type Waveform interface {
+	// Sample returns the value of the n-th sample of a wave of the given frequency,
+	// where phase is the position within the cycle in the range [0, 1).
+	Sample(n int, phase, frequency float64, sampleRate int) float64
+}
+
+// BandLimited is a Waveform whose harmonics follow a band limit. Where a band
+// limit is configured it is rendered with SampleLimited in place of Sample.
+type BandLimited interface {
+	Waveform
+	// SampleLimited is like Sample, leaving out the harmonics above the ceiling
+	// of limit and fading out those in its roll-off band.
+	SampleLimited(n int, phase, frequency float64, limit mlsic.BandLimit, sampleRate int) float64
+}
+
+var _ BandLimited = (*Wavetable)(nil)
+
+// The waveforms available out of the box. Triangle, square and saw are band-limited
+// wavetables and never sound above the ceiling of the band limit they are rendered with.
+var (
+	WaveSine     Waveform = sine{}
+	WaveTriangle Waveform = NewHarmonicWavetable(triangleHarmonics())
+	WaveSquare   Waveform = NewHarmonicWavetable(squareHarmonics())
+	WaveSaw      Waveform = NewHarmonicWavetable(sawHarmonics())
+	WaveNoise    Waveform = Noise{}
+)
+
+// wavetableSize is the number of samples of a rendered wavetable cycle.
+const wavetableSize = 2048
+
+// sine is a pure sine wave.
+type sine struct{}
+
+// Sample implements Waveform.
+func (sine) Sample(_ int, phase, _ float64, _ int) float64 {
+	return math.Sin(phase * 2.0 * math.Pi)
+}
+
+// Noise is white noise. It is deterministic: the same Seed, sample
+// and frequency always produce the same value.
+type Noise struct {
+	Seed uint64
+}
+
+// Sample implements Waveform.
+func (n Noise) Sample(sample int, _, frequency float64, _ int) float64 {
+	h := splitmix(n.Seed ^ splitmix(uint64(sample)^math.Float64bits(frequency)))
+
+	// Use the top 53 bits for a uniform value in [-1, 1).
+	return float64(h>>11)/(1<<52) - 1
+}
+
+// splitmix hashes x with the SplitMix64 finaliser.
+func splitmix(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+
+	return x ^ (x >> 31)
+}
+
+// Wavetable is a user supplied waveform. It is band-limited on playback:
+// the harmonics of the cycle that would sound above the ceiling of the
+// band limit are left out, so it does not alias.
+type Wavetable struct {
+	// cos and sin hold the amplitudes of the harmonics of the cycle,
+	// starting at the first harmonic.
+	cos, sin []float64
+
+	// tables caches the rendered cycles by number of harmonics. Each is
+	// rendered once, the first time it is needed, so Sample does not lock.
+	tables []wavetable
+}
+
+// wavetable is a cycle of a Wavetable rendered with a number of harmonics.
+type wavetable struct {
+	once    sync.Once
+	samples []float64
+}
+
+// NewWavetable returns a Wavetable playing a single cycle of a wave.
+func NewWavetable(cycle []float64) *Wavetable {
+	n := len(cycle)
+	harmonics := n / 2
+
+	cos := make([]float64, harmonics)
+	sin := make([]float64, harmonics)
+	for k := 1; k <= harmonics; k++ {
+		for i, v := range cycle {
+			angle := 2 * math.Pi * float64(k*i) / float64(n)
+			cos[k-1] += v * math.Cos(angle)
+			sin[k-1] += v * math.Sin(angle)
+		}
+
+		scale := 2 / float64(n)
+		// The Nyquist bin of an even cycle is not mirrored.
+		if n%2 == 0 && k == harmonics {
+			scale = 1 / float64(n)
+		}
+
+		cos[k-1] *= scale
+		sin[k-1] *= scale
+	}
+
+	return &Wavetable{
+		cos:    cos,
+		sin:    sin,
+		tables: make([]wavetable, harmonics+1),
+	}
+}
+
+// NewHarmonicWavetable returns a Wavetable out of the amplitudes of the sine
+// harmonics of a wave, starting at the first harmonic.
+func NewHarmonicWavetable(harmonics []float64) *Wavetable {
+	return &Wavetable{
+		cos:    make([]float64, len(harmonics)),
+		sin:    append([]float64(nil), harmonics...),
+		tables: make([]wavetable, len(harmonics)+1),
+	}
+}
+
+// Sample implements Waveform. It is band-limited by mlsic.NewBandLimit of sampleRate.
+func (w *Wavetable) Sample(n int, phase, frequency float64, sampleRate int) float64 {
+	return w.SampleLimited(n, phase, frequency, mlsic.NewBandLimit(sampleRate), sampleRate)
+}
+
+// SampleLimited implements BandLimited.
+func (w *Wavetable) SampleLimited(_ int, phase, frequency float64, limit mlsic.BandLimit, _ int) float64 {
+	// The harmonics below the roll-off band sound in full and are read from a table.
+	full := w.harmonics(frequency, limit.Ceiling-limit.RollOff)
+	table := w.table(full)
+
+	position := phase * wavetableSize
+	i := int(position)
+	fraction := position - float64(i)
+
+	v := table[i%wavetableSize]*(1-fraction) + table[(i+1)%wavetableSize]*fraction
+
+	// The few within the roll-off band are added one by one with their gain.
+	for k := full + 1; k <= w.harmonics(frequency, limit.Ceiling); k++ {
+		c, s := w.cos[k-1], w.sin[k-1]
+		if c == 0 && s == 0 {
+			continue
+		}
+
+		angle := 2 * math.Pi * float64(k) * phase
+		v += limit.Gain(float64(k)*frequency) * (c*math.Cos(angle) + s*math.Sin(angle))
+	}
+
+	return v
+}
+
+// harmonics returns the number of harmonics that sound at frequency below ceiling.
+func (w *Wavetable) harmonics(frequency, ceiling float64) int {
+	if frequency <= 0 {
+		return len(w.sin)
+	}
+
+	return max(0, min(int(ceiling/frequency), len(w.sin)))
+}
+
+// table returns the cycle rendered with the first n harmonics.
+func (w *Wavetable) table(n int) []float64 {
+	t := &w.tables[n]
+	t.once.Do(func() {
+		t.samples = make([]float64, wavetableSize)
+		for k := 1; k <= n; k++ {
+			c, s := w.cos[k-1], w.sin[k-1]
+			if c == 0 && s == 0 {
+				continue
+			}
+
+			for i := range t.samples {
+				angle := 2 * math.Pi * float64(k*i) / wavetableSize
+				t.samples[i] += c*math.Cos(angle) + s*math.Sin(angle)
+			}
+		}
+	})
+
+	return t.samples
+}
+
+// triangleHarmonics returns the Fourier series of a triangle wave.
+func triangleHarmonics() []float64 {
+	harmonics := make([]float64, wavetableSize/2)
+	for k := 1; k <= len(harmonics); k += 2 {
+		sign := 1.
+		if (k/2)%2 == 1 {
+			sign = -1.
+		}
+
+		harmonics[k-1] = sign * 8 / (math.Pi * math.Pi * float64(k*k))
+	}
+
+	return harmonics
+}
+
+// squareHarmonics returns the Fourier series of a square wave.
+func squareHarmonics() []float64 {
+	harmonics := make([]float64, wavetableSize/2)
+	for k := 1; k <= len(harmonics); k += 2 {
+		harmonics[k-1] = 4 / (math.Pi * float64(k))
+	}
+
+	return harmonics
+}
+
+// sawHarmonics returns the Fourier series of a rising saw wave.
+func sawHarmonics() []float64 {
+	harmonics := make([]float64, wavetableSize/2)
+	for k := 1; k <= len(harmonics); k++ {
+		sign := 1.
+		if k%2 == 0 {
+			sign = -1.
+		}
+
+		harmonics[k-1] = sign * 2 / (math.Pi * float64(k))
+	}
+
+	return harmonics
+}
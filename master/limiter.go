@@ -0,0 +1,107 @@
+package master
+
+import (
+	"math"
+
+	"github.com/bh90210/mlsic"
+)
+
+// limit applies a look-ahead brickwall limiter with a linear ceiling to source.
+// The channels are limited together so the image does not shift. The gain ramps down
+// over lookAhead samples before a peak and recovers with a release time constant.
+func limit(source []mlsic.Audio, ceiling float64, lookAhead, release int) {
+	var frames int
+	for _, channel := range source {
+		frames = max(frames, len(channel))
+	}
+
+	if frames == 0 {
+		return
+	}
+
+	lookAhead = max(lookAhead, 1)
+
+	// The gain each frame needs to stay below the ceiling.
+	required := make([]float64, frames)
+	for i := range required {
+		var peak float64
+		for _, channel := range source {
+			if i < len(channel) {
+				peak = math.Max(peak, math.Abs(channel[i]))
+			}
+		}
+
+		required[i] = 1
+		if peak > ceiling {
+			required[i] = ceiling / peak
+		}
+	}
+
+	hold := slidingMin(required, lookAhead)
+
+	// Averaging the held gain over the previous lookAhead frames ramps it
+	// down ahead of every peak while never rising above the gain a peak needs.
+	coefficient := 1.
+	if release > 0 {
+		coefficient = 1 - math.Exp(-1/float64(release))
+	}
+
+	sum := hold[0] * float64(lookAhead)
+	previous := 1.
+	for i := range required {
+		// Frames before the start count as the first held gain.
+		sum += hold[i] - hold[max(i-lookAhead, 0)]
+
+		g := math.Min(sum/float64(lookAhead), previous+(1-previous)*coefficient)
+		// Guard against rounding of the running sum.
+		g = math.Min(g, required[i])
+		previous = g
+
+		for _, channel := range source {
+			if i < len(channel) {
+				channel[i] *= g
+			}
+		}
+	}
+}
+
+// slidingMin returns the minimum of values over the window of size frames starting at each frame.
+func slidingMin(values []float64, size int) []float64 {
+	mins := make([]float64, len(values))
+
+	// window holds indices of values in increasing order of value.
+	var window []int
+	next := 0
+	for i := range values {
+		for ; next < len(values) && next < i+size; next++ {
+			for len(window) > 0 && values[window[len(window)-1]] >= values[next] {
+				window = window[:len(window)-1]
+			}
+
+			window = append(window, next)
+		}
+
+		for window[0] < i {
+			window = window[1:]
+		}
+
+		mins[i] = values[window[0]]
+	}
+
+	return mins
+}
+
+// softClip saturates x smoothly towards full scale above threshold.
+func softClip(x, threshold float64) float64 {
+	a := math.Abs(x)
+	if a <= threshold || threshold >= 1 {
+		return x
+	}
+
+	knee := 1 - threshold
+	y := threshold + knee*math.Tanh((a-threshold)/knee)
+	// Stay below full scale even when tanh rounds to one.
+	y = math.Min(y, math.Nextafter(1, 0))
+
+	return math.Copysign(y, x)
+}
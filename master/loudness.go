@@ -0,0 +1,142 @@
+package master
+
+import (
+	"math"
+
+	"github.com/bh90210/mlsic"
+)
+
+// Gating of the integrated loudness as in ITU-R BS.1770-4, durations in seconds.
+const (
+	blockDuration  = .4
+	blockStep      = .1
+	absoluteGate   = -70.
+	relativeGate   = -10.
+	loudnessOffset = -0.691
+)
+
+// Parameters of the K-weighting filters, from which the coefficients
+// are derived for any sample rate.
+const (
+	shelfFrequency    = 1681.974450955533
+	shelfGain         = 3.999843853973347
+	shelfGainFactor   = 0.4996667741545416
+	shelfQ            = 0.7071752369554196
+	highPassFrequency = 38.13547087602444
+	highPassQ         = 0.5003270373238773
+)
+
+// Loudness returns the integrated loudness of source in LUFS as in EBU R128,
+// or negative infinity for silence. All channels are weighted equally.
+// Sources shorter than a gating block are measured as a single block.
+func Loudness(source []mlsic.Audio, sampleRate int) float64 {
+	var frames int
+	for _, channel := range source {
+		frames = max(frames, len(channel))
+	}
+
+	if frames == 0 || sampleRate < 1 {
+		return math.Inf(-1)
+	}
+
+	// The squares of the K-weighted samples, summed over the channels.
+	power := make([]float64, frames)
+	for _, channel := range source {
+		for i, s := range kWeighting(channel, sampleRate) {
+			power[i] += s * s
+		}
+	}
+
+	blockLength := min(int(blockDuration*float64(sampleRate)), frames)
+	step := max(int(blockStep*float64(sampleRate)), 1)
+
+	var blocks []float64
+	for start := 0; start+blockLength <= frames; start += step {
+		var sum float64
+		for _, p := range power[start : start+blockLength] {
+			sum += p
+		}
+
+		blocks = append(blocks, sum/float64(blockLength))
+	}
+
+	gated := gate(blocks, absoluteGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+
+	return toLUFS(mean(gate(gated, toLUFS(mean(gated))+relativeGate)))
+}
+
+// gate returns the blocks louder than threshold LUFS.
+func gate(blocks []float64, threshold float64) []float64 {
+	var gated []float64
+	for _, b := range blocks {
+		if toLUFS(b) > threshold {
+			gated = append(gated, b)
+		}
+	}
+
+	return gated
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+
+	return sum / float64(len(values))
+}
+
+func toLUFS(power float64) float64 {
+	return loudnessOffset + 10*math.Log10(power)
+}
+
+// kWeighting returns channel filtered with the K-weighting filter, a high shelf
+// followed by a high pass, with coefficients for sampleRate.
+func kWeighting(channel mlsic.Audio, sampleRate int) []float64 {
+	k := math.Tan(math.Pi * shelfFrequency / float64(sampleRate))
+	vh := math.Pow(10, shelfGain/20)
+	vb := math.Pow(vh, shelfGainFactor)
+	a0 := 1 + k/shelfQ + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/shelfQ + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/shelfQ + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/shelfQ + k*k) / a0,
+	}
+
+	k = math.Tan(math.Pi * highPassFrequency / float64(sampleRate))
+	a0 = 1 + k/highPassQ + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/highPassQ + k*k) / a0,
+	}
+
+	return highPass.filter(shelf.filter(channel))
+}
+
+// biquad is a second order IIR filter.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// filter returns in filtered in direct form I.
+func (f biquad) filter(in []float64) []float64 {
+	out := make([]float64, len(in))
+
+	var x1, x2, y1, y2 float64
+	for i, x := range in {
+		y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+		x2, x1 = x1, x
+		y2, y1 = y1, y
+		out[i] = y
+	}
+
+	return out
+}
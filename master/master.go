@@ -0,0 +1,236 @@
+// Package master holds the mastering stage that runs over audio before it is rendered.
+// It offers peak and loudness (EBU R128) normalization, a look-ahead brickwall limiter,
+// a soft clipper and reports the samples that clip.
+package master
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/bh90210/mlsic"
+)
+
+var _ mlsic.Renderer = (*Master)(nil)
+
+// Master masters the audio passed to Render before handing it to its Renderer.
+// The stages run in order: normalization, limiter, soft clipper and clip detection.
+// Stages that are not set are skipped.
+type Master struct {
+	renderer   mlsic.Renderer
+	sampleRate int
+
+	peak     *float64
+	loudness *float64
+
+	ceiling   *float64
+	lookAhead time.Duration
+	release   time.Duration
+
+	softClip *float64
+
+	report Report
+}
+
+// Report describes the audio before and after mastering.
+type Report struct {
+	// InputPeak and OutputPeak are the sample peaks in dBFS.
+	InputPeak, OutputPeak float64
+	// InputLoudness and OutputLoudness are the integrated loudness in LUFS.
+	InputLoudness, OutputLoudness float64
+	// InputClips and OutputClips are the number of samples at or
+	// beyond full scale (±1) of each channel.
+	InputClips, OutputClips []int
+}
+
+// Clipped reports whether any sample still clips after mastering.
+func (r Report) Clipped() bool {
+	for _, c := range r.OutputClips {
+		if c > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Option is a custom type function that accepts *Master
+// and is used by the WithXXX New options functions.
+type Option func(*Master)
+
+// New returns a Master rendering with renderer.
+func New(renderer mlsic.Renderer, opts ...Option) *Master {
+	m := &Master{
+		renderer:   renderer,
+		sampleRate: mlsic.SampleRate,
+		lookAhead:  5 * time.Millisecond,
+		release:    50 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// WithSampleRate sets the sample rate of the audio. If not set mlsic.SampleRate is used.
+func WithSampleRate(sampleRate int) Option {
+	return func(m *Master) {
+		m.sampleRate = sampleRate
+	}
+}
+
+// WithPeak normalizes the audio so its sample peak is at peak dBFS.
+// It overrides WithLoudness.
+func WithPeak(peak float64) Option {
+	return func(m *Master) {
+		m.peak = &peak
+		m.loudness = nil
+	}
+}
+
+// WithLoudness normalizes the audio so its integrated loudness is at loudness LUFS.
+// EBU R128 recommends -23 LUFS. It overrides WithPeak.
+func WithLoudness(loudness float64) Option {
+	return func(m *Master) {
+		m.loudness = &loudness
+		m.peak = nil
+	}
+}
+
+// WithLimiter limits the audio so no sample peaks above ceiling dBFS.
+func WithLimiter(ceiling float64) Option {
+	return func(m *Master) {
+		m.ceiling = &ceiling
+	}
+}
+
+// WithLookAhead sets how early the limiter starts to reduce the gain
+// before a peak. If not set it is 5 milliseconds.
+func WithLookAhead(lookAhead time.Duration) Option {
+	return func(m *Master) {
+		m.lookAhead = lookAhead
+	}
+}
+
+// WithRelease sets how fast the limiter recovers after a peak. If not set it is 50 milliseconds.
+func WithRelease(release time.Duration) Option {
+	return func(m *Master) {
+		m.release = release
+	}
+}
+
+// WithSoftClip saturates the samples above threshold, a linear amplitude
+// between 0 and 1, smoothly towards full scale.
+func WithSoftClip(threshold float64) Option {
+	return func(m *Master) {
+		m.softClip = &threshold
+	}
+}
+
+// Render masters a copy of source and renders it, leaving source as it is.
+// Clips left after mastering are logged.
+func (m *Master) Render(source []mlsic.Audio, name string) error {
+	mastered := make([]mlsic.Audio, len(source))
+	for i, channel := range source {
+		mastered[i] = slices.Clone(channel)
+	}
+
+	source = mastered
+
+	m.report = m.Process(source)
+
+	if m.report.Clipped() {
+		log.Warn().Ints("clips", m.report.OutputClips).Str("name", name).Msg("audio clips after mastering")
+	}
+
+	return m.renderer.Render(source, name)
+}
+
+// Report returns the report of the last Render.
+func (m *Master) Report() Report {
+	return m.report
+}
+
+// Process masters source in place and returns its report.
+func (m *Master) Process(source []mlsic.Audio) Report {
+	report := Report{
+		InputPeak:     Peak(source),
+		InputLoudness: Loudness(source, m.sampleRate),
+		InputClips:    Clips(source),
+	}
+
+	switch {
+	case m.peak != nil && !math.IsInf(report.InputPeak, -1):
+		gain(source, FromDB(*m.peak-report.InputPeak))
+
+	case m.loudness != nil && !math.IsInf(report.InputLoudness, -1):
+		gain(source, FromDB(*m.loudness-report.InputLoudness))
+	}
+
+	if m.ceiling != nil {
+		limit(source, FromDB(*m.ceiling), mlsic.DurationInSamples(m.lookAhead, m.sampleRate), mlsic.DurationInSamples(m.release, m.sampleRate))
+	}
+
+	if m.softClip != nil {
+		for _, channel := range source {
+			for i, s := range channel {
+				channel[i] = softClip(s, *m.softClip)
+			}
+		}
+	}
+
+	report.OutputPeak = Peak(source)
+	report.OutputLoudness = Loudness(source, m.sampleRate)
+	report.OutputClips = Clips(source)
+
+	return report
+}
+
+// Peak returns the sample peak of source in dBFS.
+func Peak(source []mlsic.Audio) float64 {
+	var peak float64
+	for _, channel := range source {
+		for _, s := range channel {
+			peak = math.Max(peak, math.Abs(s))
+		}
+	}
+
+	return ToDB(peak)
+}
+
+// Clips returns the number of samples at or beyond full scale (±1) of each channel.
+func Clips(source []mlsic.Audio) []int {
+	clips := make([]int, len(source))
+	for c, channel := range source {
+		for _, s := range channel {
+			if s >= 1. || s <= -1. {
+				clips[c]++
+			}
+		}
+	}
+
+	return clips
+}
+
+// ToDB converts a linear amplitude to decibels.
+func ToDB(amplitude float64) float64 {
+	return 20 * math.Log10(amplitude)
+}
+
+// FromDB converts decibels to a linear amplitude.
+func FromDB(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// gain multiplies every sample of source with g.
+func gain(source []mlsic.Audio, g float64) {
+	for _, channel := range source {
+		for i := range channel {
+			channel[i] *= g
+		}
+	}
+}
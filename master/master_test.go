@@ -0,0 +1,103 @@
+package master
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bh90210/mlsic"
+)
+
+// sine returns seconds of a sine wave of frequency and amplitude.
+func sine(frequency, amplitude, seconds float64) mlsic.Audio {
+	signal := make(mlsic.Audio, int(seconds*mlsic.SampleRate))
+	for i := range signal {
+		signal[i] = amplitude * math.Sin(2*math.Pi*frequency*float64(i)/mlsic.SampleRate)
+	}
+
+	return signal
+}
+
+type renderer struct {
+	source []mlsic.Audio
+}
+
+func (r *renderer) Render(source []mlsic.Audio, _ string) error {
+	r.source = source
+	return nil
+}
+
+func TestLoudness(t *testing.T) {
+	a := assert.New(t)
+
+	// A full scale 997 Hz sine in a single channel measures -3.01 LUFS.
+	a.InDelta(-3.01, Loudness([]mlsic.Audio{sine(997, 1, 5)}, mlsic.SampleRate), .05)
+	a.InDelta(-23.01, Loudness([]mlsic.Audio{sine(997, .1, 5)}, mlsic.SampleRate), .05)
+	a.InDelta(-20., Loudness([]mlsic.Audio{sine(997, .1, 5), sine(997, .1, 5)}, mlsic.SampleRate), .05)
+
+	a.True(math.IsInf(Loudness([]mlsic.Audio{make(mlsic.Audio, mlsic.SampleRate)}, mlsic.SampleRate), -1))
+	a.True(math.IsInf(Loudness(nil, mlsic.SampleRate), -1))
+}
+
+func TestNormalize(t *testing.T) {
+	a := assert.New(t)
+
+	r := &renderer{}
+	m := New(r, WithPeak(-6))
+	source := []mlsic.Audio{sine(440, .1, 1)}
+	a.NoError(m.Render(source, "peak"))
+	a.InDelta(-6, Peak(r.source), 1e-9)
+	a.InDelta(-20, m.Report().InputPeak, 1e-3)
+
+	// Render masters a copy, the source is left as it is.
+	a.InDelta(-20, Peak(source), 1e-3)
+
+	m = New(r, WithLoudness(-23))
+	a.NoError(m.Render([]mlsic.Audio{sine(997, .5, 3)}, "loudness"))
+	a.InDelta(-23, Loudness(r.source, mlsic.SampleRate), 1e-6)
+	a.InDelta(-23, m.Report().OutputLoudness, 1e-6)
+}
+
+func TestLimiter(t *testing.T) {
+	a := assert.New(t)
+
+	signal := sine(440, .5, 1)
+	// A burst far above full scale.
+	for i := 20000; i < 20100; i++ {
+		signal[i] *= 4
+	}
+
+	source := []mlsic.Audio{signal, sine(440, .25, 1)}
+	report := New(nil, WithLimiter(-1), WithLookAhead(2*time.Millisecond)).Process(source)
+
+	a.NotZero(report.InputClips[0])
+	a.Zero(report.InputClips[1])
+	a.False(report.Clipped())
+	a.LessOrEqual(Peak(source), -1.+1e-9)
+
+	// Away from the burst the signal is untouched.
+	a.Equal(sine(440, .5, 1)[:10000], source[0][:10000])
+	a.Equal(sine(440, .25, 1)[:10000], source[1][:10000])
+
+	// Both channels are reduced by the same gain.
+	a.InDelta(source[0][20050]/8, source[1][20050], 1e-12)
+}
+
+func TestSoftClip(t *testing.T) {
+	a := assert.New(t)
+
+	source := []mlsic.Audio{sine(440, 2, 1)}
+	report := New(nil, WithSoftClip(.8)).Process(source)
+
+	a.NotZero(report.InputClips[0])
+	a.Zero(report.OutputClips[0])
+	a.False(report.Clipped())
+
+	a.Equal(.5, softClip(.5, .8))
+	a.Equal(-.5, softClip(-.5, .8))
+	a.Less(softClip(.9, .8), .9)
+	a.Less(softClip(100, .8), 1.)
+	a.Equal(-softClip(1.5, .8), softClip(-1.5, .8))
+}
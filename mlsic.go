@@ -3,11 +3,9 @@ package mlsic
 
 import (
 	"time"
-
-	"github.com/rs/zerolog/log"
 )
 
-// SampleRate should always be 44.1, the module doesn't support higher or lower sampling rates.
+// SampleRate is the default sampling rate used when none is explicitly set.
 const SampleRate = 44100
 
 // MaxFrequency allowed.
@@ -45,14 +43,21 @@ const (
 // Audio is a 64 bit float slice with PCM signal values from -1.0 to 1.0.
 type Audio []float64
 
-// Reader .
+// Reader is the interface that wraps the basic Read method of streaming audio sources.
+//
+// Read reads interleaved frames, one sample per channel, into p and returns the number
+// of samples read. Only whole frames are read so n is always a multiple of the number
+// of channels. At the end of the stream Read returns 0, io.EOF.
 type Reader interface {
-	Read(Audio) (int, error)
+	Read(p Audio) (n int, err error)
 }
 
-// Writer .
+// Writer is the interface that wraps the basic Write method of streaming audio sinks.
+//
+// Write writes the interleaved frames of p and returns the number of samples written.
+// len(p) must be a multiple of the number of channels the Writer was set up with.
 type Writer interface {
-	Write(Audio) (int, error)
+	Write(p Audio) (n int, err error)
 }
 
 // Renderer .
@@ -165,7 +170,6 @@ func Panning(noOfSpeakers, speakerNumber int, originalPanning float64) (panning
 		}
 	}
 
-	log.Debug().Float64("pan", panning).Int("speakers", noOfSpeakers).Int("speaker", speakerNumber+1).Msg("panning calculation")
 	return
 }
 
@@ -187,17 +191,46 @@ type Partial struct {
 	Start time.Duration
 	// Duration of the partial in milliseconds.
 	Duration time.Duration
+	// PanningCurve moves the partial through space, from its start. If not set
+	// the partial follows the panning of its fundamental.
+	PanningCurve Curve
+	// Envelope shapes the amplitude of the partial over its duration.
+	Envelope Envelope
+}
+
+// DurationInSamples returns the duration of the partial in samples for the given sample rate.
+func (p Partial) DurationInSamples(sampleRate int) int {
+	return DurationInSamples(p.Duration, sampleRate)
 }
 
-// SignalLengthMultiplier this is a bit lame, fix it! TODO:
-const SignalLengthMultiplier = 44
+// StartInSamples returns the starting point of the partial in samples for the given sample rate.
+func (p Partial) StartInSamples(sampleRate int) int {
+	return DurationInSamples(p.Start, sampleRate)
+}
+
+// DurationInSamples converts a duration to a number of samples for the given sample rate.
+// The result is rounded to the nearest sample so sub-millisecond durations are preserved.
+// Negative durations are treated as their absolute value.
+//
+// Rounding is up to half a sample off, so summing the sample counts of consecutive
+// durations drifts. Positions on a timeline are computed from their absolute time instead.
+func DurationInSamples(d time.Duration, sampleRate int) int {
+	d = d.Abs()
 
-// DurationInSamples .
-func (p Partial) DurationInSamples() int {
-	return int(SignalLengthMultiplier * p.Duration.Abs().Milliseconds())
+	// Seconds and remainder are converted separately so that long durations
+	// at high sample rates do not overflow.
+	seconds := int64(d / time.Second)
+	remainder := int64(d % time.Second)
+
+	return int(seconds*int64(sampleRate) + (remainder*int64(sampleRate)+int64(time.Second)/2)/int64(time.Second))
 }
 
-// StartInSamples .
-func (p Partial) StartInSamples() int {
-	return int(SignalLengthMultiplier * p.Start.Abs().Milliseconds())
+// SamplesInDuration converts a number of samples to a duration for the given sample rate.
+// It is the inverse of DurationInSamples, rounded to the nearest nanosecond.
+func SamplesInDuration(samples, sampleRate int) time.Duration {
+	seconds := int64(samples / sampleRate)
+	remainder := int64(samples % sampleRate)
+
+	return time.Duration(seconds)*time.Second +
+		time.Duration((remainder*int64(time.Second)+int64(sampleRate)/2)/int64(sampleRate))
 }
@@ -1,7 +1,9 @@
 package mlsic
 
 import (
+	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -45,6 +47,16 @@ func TestPanning(t *testing.T) {
 		"four speakers, between first speaker and fourth speaker, speaker 3": {noOfSpeakers: 4, speakerNumber: Speaker3, originalPanning: 0., want: 0.},
 		"four speakers, between first speaker and fourth speaker, speaker 4": {noOfSpeakers: 4, speakerNumber: Speaker4, originalPanning: 0., want: 0.5},
 
+		"four speakers, hard pan right wraps around, speaker 1": {noOfSpeakers: 4, speakerNumber: Speaker1, originalPanning: 1., want: 0.5},
+		"four speakers, hard pan right wraps around, speaker 2": {noOfSpeakers: 4, speakerNumber: Speaker2, originalPanning: 1., want: 0.},
+		"four speakers, hard pan right wraps around, speaker 3": {noOfSpeakers: 4, speakerNumber: Speaker3, originalPanning: 1., want: 0.},
+		"four speakers, hard pan right wraps around, speaker 4": {noOfSpeakers: 4, speakerNumber: Speaker4, originalPanning: 1., want: 0.5},
+
+		"four speakers, between first and second speaker, speaker 1": {noOfSpeakers: 4, speakerNumber: Speaker1, originalPanning: 0.25, want: 0.5},
+		"four speakers, between first and second speaker, speaker 2": {noOfSpeakers: 4, speakerNumber: Speaker2, originalPanning: 0.25, want: 0.5},
+		"four speakers, between first and second speaker, speaker 3": {noOfSpeakers: 4, speakerNumber: Speaker3, originalPanning: 0.25, want: 0.},
+		"four speakers, between first and second speaker, speaker 4": {noOfSpeakers: 4, speakerNumber: Speaker4, originalPanning: 0.25, want: 0.},
+
 		"four speakers, above mid on second speaker, speaker 1": {noOfSpeakers: 4, speakerNumber: Speaker1, originalPanning: 0.4, want: 0.},
 		"four speakers, above mid on second speaker, speaker 2": {noOfSpeakers: 4, speakerNumber: Speaker2, originalPanning: 0.4, want: 0.8999999999999999},
 		"four speakers, above mid on second speaker, speaker 3": {noOfSpeakers: 4, speakerNumber: Speaker3, originalPanning: 0.4, want: 0.10000000000000009},
@@ -68,3 +80,132 @@ func TestPanning(t *testing.T) {
 		})
 	}
 }
+
+func TestPartialInSamples(t *testing.T) {
+	p := Partial{
+		Start:    time.Duration(10 * time.Millisecond),
+		Duration: time.Duration(1000 * time.Millisecond),
+	}
+
+	assert.Equal(t, 441, p.StartInSamples(SampleRate))
+	assert.Equal(t, 44100, p.DurationInSamples(SampleRate))
+
+	assert.Equal(t, 480, p.StartInSamples(48000))
+	assert.Equal(t, 96000, p.DurationInSamples(96000))
+}
+
+func TestDurationInSamples(t *testing.T) {
+	tests := map[string]struct {
+		duration   time.Duration
+		sampleRate int
+		want       int
+	}{
+		"zero":                  {duration: 0, sampleRate: SampleRate, want: 0},
+		"one second 44.1kHz":    {duration: time.Second, sampleRate: SampleRate, want: 44100},
+		"one second 48kHz":      {duration: time.Second, sampleRate: 48000, want: 48000},
+		"one second 96kHz":      {duration: time.Second, sampleRate: 96000, want: 96000},
+		"one millisecond":       {duration: time.Millisecond, sampleRate: SampleRate, want: 44},
+		"ten milliseconds":      {duration: 10 * time.Millisecond, sampleRate: SampleRate, want: 441},
+		"half a millisecond":    {duration: 500 * time.Microsecond, sampleRate: SampleRate, want: 22},
+		"hundred microseconds":  {duration: 100 * time.Microsecond, sampleRate: 48000, want: 5},
+		"single sample":         {duration: 22676 * time.Nanosecond, sampleRate: SampleRate, want: 1},
+		"negative one second":   {duration: -time.Second, sampleRate: SampleRate, want: 44100},
+		"one hour 96kHz":        {duration: time.Hour, sampleRate: 96000, want: 345600000},
+		"one day 192kHz":        {duration: 24 * time.Hour, sampleRate: 192000, want: 16588800000},
+		"minute and a fraction": {duration: time.Minute + 250*time.Millisecond, sampleRate: SampleRate, want: 2657025},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := DurationInSamples(tc.duration, tc.sampleRate)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSamplesInDuration(t *testing.T) {
+	assert.Equal(t, time.Second, SamplesInDuration(44100, SampleRate))
+	assert.Equal(t, time.Hour, SamplesInDuration(345600000, 96000))
+	assert.Equal(t, 20833*time.Nanosecond, SamplesInDuration(1, 48000))
+
+	// A thousand one millisecond tones placed back to back, using
+	// the sample count of their accumulated duration, span exactly one second.
+	var position int
+	for i := 1; i <= 1000; i++ {
+		position = DurationInSamples(time.Duration(i)*time.Millisecond, SampleRate)
+	}
+
+	assert.Equal(t, 44100, position)
+	assert.Equal(t, time.Second, SamplesInDuration(position, SampleRate))
+}
+
+func TestPanLaws(t *testing.T) {
+	a := assert.New(t)
+
+	// Linear is today's Panning.
+	a.Equal(Panning(4, Speaker2, 0.4), LinearPanLaw(4, Speaker2, 0.4))
+
+	// Hard panned signals are unaffected by the law.
+	for _, law := range []PanLaw{LinearPanLaw, EqualPowerPanLaw, CompromisePanLaw} {
+		a.InDelta(1., law(TwoSpeakers, Speaker1, 0.), 1e-9)
+		a.InDelta(0., law(TwoSpeakers, Speaker2, 0.), 1e-9)
+		a.InDelta(1., law(OneSpeaker, Speaker1, 0.3), 1e-9)
+	}
+
+	// On rings of three or more speakers both ends are the same point,
+	// halfway between the last speaker and the first.
+	for _, law := range []PanLaw{LinearPanLaw, EqualPowerPanLaw, CompromisePanLaw} {
+		for _, speakers := range []int{3, 4} {
+			for speaker := 0; speaker < speakers; speaker++ {
+				a.InDelta(law(speakers, speaker, 0.), law(speakers, speaker, 1.), 1e-9)
+			}
+
+			a.InDelta(law(speakers, Speaker1, 0.), law(speakers, speakers-1, 0.), 1e-9)
+			a.Greater(law(speakers, Speaker1, 0.), 0.)
+		}
+	}
+
+	// Center.
+	a.InDelta(-6.02, decibels(LinearPanLaw(TwoSpeakers, Speaker1, 0.5)), 0.01)
+	a.InDelta(-3.01, decibels(EqualPowerPanLaw(TwoSpeakers, Speaker1, 0.5)), 0.01)
+	a.InDelta(-4.52, decibels(CompromisePanLaw(TwoSpeakers, Speaker2, 0.5)), 0.01)
+
+	// Equal power keeps the power constant between adjacent speakers.
+	for _, panning := range []float64{0.1, 0.3, 0.45, 0.6, 0.95} {
+		var power float64
+		for speaker := 0; speaker < 4; speaker++ {
+			power += math.Pow(EqualPowerPanLaw(4, speaker, panning), 2)
+		}
+
+		a.InDelta(1., power, 1e-9, panning)
+	}
+}
+
+func decibels(gain float64) float64 {
+	return 20 * math.Log10(gain)
+}
+
+func TestBandLimit(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(BandLimit{Ceiling: MaxFrequency}, NewBandLimit(SampleRate))
+	a.Equal(BandLimit{Ceiling: 8000}, NewBandLimit(16000))
+
+	limit := BandLimit{Ceiling: 10000}
+	a.Equal(1., limit.Gain(10000))
+	a.Zero(limit.Gain(10000.1))
+
+	limit.RollOff = 2000
+	a.Equal(1., limit.Gain(5000))
+	a.Equal(1., limit.Gain(8000))
+	a.InDelta(.5, limit.Gain(9000), 1e-12)
+	a.Zero(limit.Gain(10000))
+	a.Zero(limit.Gain(12000))
+
+	// The gain falls steadily through the roll-off band.
+	previous := 1.
+	for f := 8000.; f <= 10000; f += 10 {
+		a.LessOrEqual(limit.Gain(f), previous)
+		previous = limit.Gain(f)
+	}
+}
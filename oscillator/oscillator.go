@@ -0,0 +1,139 @@
+// Package oscillator holds sine wave oscillators that are faster than calling
+// math.Sin for every sample. They differ from math.Sin by at most their Tolerance.
+package oscillator
+
+import "math"
+
+// Oscillator renders sine waves of a steady frequency.
+type Oscillator interface {
+	// Signal fills out with a sine wave of frequency, starting at phase, in cycles,
+	// and returns the phase of the sample following the last one.
+	Signal(out []float64, frequency, phase float64, sampleRate int) float64
+	// Tolerance is the largest difference of a sample to math.Sin.
+	Tolerance() float64
+}
+
+// The oscillators available.
+var (
+	// Exact calls math.Sin for every sample.
+	Exact Oscillator = exact{}
+	// Table looks up a sine table with linear interpolation.
+	Table Oscillator = newTable(4096)
+	// Recursive is a recursive (second order resonator) oscillator.
+	Recursive Oscillator = recursive{}
+)
+
+// exact calls math.Sin for every sample.
+type exact struct{}
+
+// Signal implements Oscillator.
+func (exact) Signal(out []float64, frequency, phase float64, sampleRate int) float64 {
+	increment := frequency / float64(sampleRate)
+	for i := range out {
+		out[i] = math.Sin(phase * 2.0 * math.Pi)
+		_, phase = math.Modf(phase + increment)
+	}
+
+	return phase
+}
+
+// Tolerance implements Oscillator.
+func (exact) Tolerance() float64 {
+	return 0
+}
+
+// table looks up a single sine cycle with linear interpolation.
+type table struct {
+	// cycle holds size samples and a guard sample, so that
+	// interpolation never has to wrap around.
+	cycle []float64
+	size  float64
+}
+
+func newTable(size int) *table {
+	cycle := make([]float64, size+1)
+	for i := range cycle {
+		cycle[i] = math.Sin(2 * math.Pi * float64(i) / float64(size))
+	}
+
+	return &table{
+		cycle: cycle,
+		size:  float64(size),
+	}
+}
+
+// Signal implements Oscillator.
+func (t *table) Signal(out []float64, frequency, phase float64, sampleRate int) float64 {
+	increment := frequency / float64(sampleRate)
+	phase = wrap(phase)
+	for i := range out {
+		position := phase * t.size
+		index := int(position)
+		fraction := position - float64(index)
+
+		out[i] = t.cycle[index] + (t.cycle[index+1]-t.cycle[index])*fraction
+
+		phase = wrap(phase + increment)
+	}
+
+	return phase
+}
+
+// Tolerance implements Oscillator. The error of linear interpolation
+// is at most (2π/size)²/8.
+func (t *table) Tolerance() float64 {
+	return math.Pow(2*math.Pi/t.size, 2) / 8
+}
+
+// wrap returns phase on the cycle, in [0, 1).
+func wrap(phase float64) float64 {
+	if phase >= 1 || phase < 0 {
+		phase -= math.Floor(phase)
+	}
+
+	// Tiny negative phases round up to a whole cycle.
+	if phase >= 1 {
+		return 0
+	}
+
+	return phase
+}
+
+// resync is how many samples the recursive oscillator runs before
+// it starts over from math.Sin, so that rounding errors do not build up.
+const resync = 1024
+
+// recursive runs the recurrence sin(x+w) = 2cos(w)sin(x) - sin(x-w).
+type recursive struct{}
+
+// Signal implements Oscillator.
+func (recursive) Signal(out []float64, frequency, phase float64, sampleRate int) float64 {
+	increment := frequency / float64(sampleRate)
+	w := 2 * math.Pi * increment
+	c := 2 * math.Cos(w)
+
+	for start := 0; start < len(out); start += resync {
+		block := out[start:min(start+resync, len(out))]
+
+		_, p := math.Modf(phase + float64(start)*increment)
+		x := 2 * math.Pi * p
+		previous := math.Sin(x - w)
+		current := math.Sin(x)
+		for i := range block {
+			block[i] = current
+			current, previous = c*current-previous, current
+		}
+	}
+
+	_, phase = math.Modf(phase + float64(len(out))*increment)
+	if phase < 0 {
+		phase++
+	}
+
+	return phase
+}
+
+// Tolerance implements Oscillator.
+func (recursive) Tolerance() float64 {
+	return 1e-9
+}
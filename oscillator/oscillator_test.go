@@ -0,0 +1,35 @@
+package oscillator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOscillators(t *testing.T) {
+	a := assert.New(t)
+
+	want := make([]float64, 44100*10)
+	got := make([]float64, len(want))
+
+	for _, frequency := range []float64{27.5, 440., 3520.1, 18000.} {
+		for _, phase := range []float64{0, .3, 1, 2.3, -.7, -1e-17} {
+			wantPhase := Exact.Signal(want, frequency, phase, 44100)
+
+			for name, o := range map[string]Oscillator{"table": Table, "recursive": Recursive} {
+				gotPhase := o.Signal(got, frequency, phase, 44100)
+
+				var worst float64
+				for i := range want {
+					worst = math.Max(worst, math.Abs(want[i]-got[i]))
+				}
+
+				a.LessOrEqual(worst, o.Tolerance(), "%s at %v", name, frequency)
+				// Phases compare on the cycle, 0 and 1 are the same point.
+				distance := math.Abs(wantPhase - gotPhase)
+				a.LessOrEqual(math.Min(distance, 1-distance), 1e-6, "%s at %v", name, frequency)
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package mlsic
+
+import (
+	"math"
+)
+
+// PanLaw returns the ratio to multiply the signal for speakerNumber out of noOfSpeakers,
+// for a panning value between zero and one. Panning is the linear pan law.
+// Vector base amplitude panning depends on where the speakers are, so it is
+// not a PanLaw but a setting of the Layout, see Layout.VBAP.
+type PanLaw func(noOfSpeakers, speakerNumber int, originalPanning float64) float64
+
+var (
+	// LinearPanLaw crossfades linearly between adjacent speakers. It is the default pan law.
+	LinearPanLaw PanLaw = Panning
+
+	// EqualPowerPanLaw crossfades between adjacent speakers along a quarter sine, keeping
+	// the power constant. A signal panned between two speakers is 3 dB down on each.
+	EqualPowerPanLaw PanLaw = func(noOfSpeakers, speakerNumber int, originalPanning float64) float64 {
+		return equalPower(Panning(noOfSpeakers, speakerNumber, originalPanning))
+	}
+
+	// CompromisePanLaw is halfway, in decibels, between the linear and the equal power pan laws.
+	// A signal panned between two speakers is 4.5 dB down on each.
+	CompromisePanLaw PanLaw = func(noOfSpeakers, speakerNumber int, originalPanning float64) float64 {
+		linear := Panning(noOfSpeakers, speakerNumber, originalPanning)
+		return math.Sqrt(linear * equalPower(linear))
+	}
+)
+
+// equalPower maps a linear gain to its equal power counterpart.
+func equalPower(linear float64) float64 {
+	return math.Sin(linear * math.Pi / 2)
+}
+
+// vbapPair returns the gains of the speakers at azimuths a and b for a source at azimuth source,
+// normalized to constant power.
+func vbapPair(a, b, source float64) (float64, float64) {
+	rad := math.Pi / 180
+
+	ax, ay := math.Cos(a*rad), math.Sin(a*rad)
+	bx, by := math.Cos(b*rad), math.Sin(b*rad)
+	px, py := math.Cos(source*rad), math.Sin(source*rad)
+
+	det := ax*by - bx*ay
+	// Speakers in line with the listener can not form a base.
+	if math.Abs(det) < 1e-9 {
+		if math.Abs(source-a) <= math.Abs(source-b) {
+			return 1, 0
+		}
+
+		return 0, 1
+	}
+
+	// Solve p = ga*a + gb*b.
+	ga := math.Max(0, (px*by-bx*py)/det)
+	gb := math.Max(0, (ax*py-px*ay)/det)
+
+	norm := math.Hypot(ga, gb)
+	if norm == 0 {
+		return 0, 0
+	}
+
+	return ga / norm, gb / norm
+}
@@ -0,0 +1,279 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand"
+
+	"github.com/go-audio/audio"
+	"github.com/go-audio/wav"
+)
+
+// aifcVersion is the timestamp of the AIFF-C version 1 specification.
+const aifcVersion = 0xA2805140
+
+// aiffEncoder writes interleaved float64 frames as an .aiff file.
+// Float encodings are written as AIFF-C (fl32 and fl64 compression types.)
+type aiffEncoder struct {
+	w io.WriteSeeker
+
+	sampleRate int
+	channels   int
+	encoding   Encoding
+	meta       *wav.Metadata
+	// dither is the source of the triangular dither noise added before
+	// quantizing to integer samples. Dither is disabled when nil.
+	dither *rand.Rand
+
+	frames       int
+	written      int64
+	commFramePos int64
+	ssndSizePos  int64
+	wroteHeader  bool
+	buf          bytes.Buffer
+}
+
+func newAiffEncoder(w io.WriteSeeker, sampleRate, channels int, encoding Encoding) *aiffEncoder {
+	return &aiffEncoder{
+		w:          w,
+		sampleRate: sampleRate,
+		channels:   channels,
+		encoding:   encoding,
+	}
+}
+
+func (e *aiffEncoder) add(src any) error {
+	e.written += int64(binary.Size(src))
+	return binary.Write(e.w, binary.BigEndian, src)
+}
+
+func (e *aiffEncoder) writeHeader() error {
+	e.wroteHeader = true
+
+	form := [4]byte{'A', 'I', 'F', 'F'}
+	if e.encoding.IsFloat() {
+		form = [4]byte{'A', 'I', 'F', 'C'}
+	}
+
+	header := []any{
+		[4]byte{'F', 'O', 'R', 'M'},
+		// Form size, updated on close.
+		uint32(0),
+		form,
+	}
+
+	if e.encoding.IsFloat() {
+		header = append(header, [4]byte{'F', 'V', 'E', 'R'}, uint32(4), uint32(aifcVersion))
+	}
+
+	for _, v := range header {
+		if err := e.add(v); err != nil {
+			return err
+		}
+	}
+
+	var compression []any
+	switch e.encoding {
+	case Float32:
+		compression = []any{[4]byte{'f', 'l', '3', '2'}, pascalString("32-bit floating point")}
+
+	case Float64:
+		compression = []any{[4]byte{'f', 'l', '6', '4'}, pascalString("64-bit floating point")}
+	}
+
+	commSize := 18
+	for _, v := range compression {
+		commSize += binary.Size(v)
+	}
+
+	if err := e.add([4]byte{'C', 'O', 'M', 'M'}); err != nil {
+		return err
+	}
+
+	if err := e.add(uint32(commSize)); err != nil {
+		return err
+	}
+
+	if err := e.add(uint16(e.channels)); err != nil {
+		return err
+	}
+
+	e.commFramePos = e.written
+
+	comm := []any{
+		// Number of frames, updated on close.
+		uint32(0),
+		uint16(e.encoding.BitDepth()),
+		audio.IntToIEEEFloat(e.sampleRate),
+	}
+
+	for _, v := range append(comm, compression...) {
+		if err := e.add(v); err != nil {
+			return err
+		}
+	}
+
+	if e.meta != nil {
+		if err := e.writeMetadata(); err != nil {
+			return err
+		}
+	}
+
+	if err := e.add([4]byte{'S', 'S', 'N', 'D'}); err != nil {
+		return err
+	}
+
+	e.ssndSizePos = e.written
+
+	// Chunk size updated on close, followed by offset and block size.
+	for _, v := range []uint32{0, 0, 0} {
+		if err := e.add(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeMetadata maps the metadata to the AIFF text chunks. Title, Artist,
+// Copyright and Comments have dedicated chunks, the rest become annotations.
+func (e *aiffEncoder) writeMetadata() error {
+	chunks := []struct {
+		id    [4]byte
+		value string
+	}{
+		{[4]byte{'N', 'A', 'M', 'E'}, e.meta.Title},
+		{[4]byte{'A', 'U', 'T', 'H'}, e.meta.Artist},
+		{[4]byte{'(', 'c', ')', ' '}, e.meta.Copyright},
+		{[4]byte{'A', 'N', 'N', 'O'}, e.meta.Comments},
+	}
+
+	annotations := []struct {
+		key   string
+		value string
+	}{
+		{"Creation date", e.meta.CreationDate},
+		{"Engineer", e.meta.Engineer},
+		{"Technician", e.meta.Technician},
+		{"Genre", e.meta.Genre},
+		{"Keywords", e.meta.Keywords},
+		{"Medium", e.meta.Medium},
+		{"Product", e.meta.Product},
+		{"Subject", e.meta.Subject},
+		{"Software", e.meta.Software},
+		{"Source", e.meta.Source},
+		{"Location", e.meta.Location},
+		{"Track", e.meta.TrackNbr},
+	}
+
+	for _, a := range annotations {
+		if a.value == "" {
+			continue
+		}
+
+		chunks = append(chunks, struct {
+			id    [4]byte
+			value string
+		}{[4]byte{'A', 'N', 'N', 'O'}, a.key + ": " + a.value})
+	}
+
+	for _, c := range chunks {
+		if c.value == "" {
+			continue
+		}
+
+		if err := e.add(c.id); err != nil {
+			return err
+		}
+
+		if err := e.add(uint32(len(c.value))); err != nil {
+			return err
+		}
+
+		text := []byte(c.value)
+		// Chunks must be word aligned.
+		if len(text)%2 == 1 {
+			text = append(text, 0x00)
+		}
+
+		if err := e.add(text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// write encodes interleaved frames. len(frames) must be a multiple of the number of channels.
+func (e *aiffEncoder) write(frames []float64) error {
+	if !e.wroteHeader {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	e.buf.Reset()
+	encodeSamples(&e.buf, binary.BigEndian, e.encoding, e.dither, frames)
+
+	n, err := e.w.Write(e.buf.Bytes())
+	e.written += int64(n)
+	e.frames += len(frames) / e.channels
+
+	return err
+}
+
+// length returns the number of bytes written so far.
+func (e *aiffEncoder) length() int64 {
+	return e.written
+}
+
+// close updates the chunk sizes and the number of frames.
+// Note that the underlying writer is not closed.
+func (e *aiffEncoder) close() error {
+	if !e.wroteHeader {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	ssndSize := e.written - e.ssndSizePos - 4
+	// Chunks must be word aligned.
+	if ssndSize%2 == 1 {
+		if err := e.add(uint8(0)); err != nil {
+			return err
+		}
+	}
+
+	updates := []struct {
+		pos   int64
+		value uint32
+	}{
+		{4, uint32(e.written - 8)},
+		{e.commFramePos, uint32(e.frames)},
+		{e.ssndSizePos, uint32(ssndSize)},
+	}
+
+	for _, u := range updates {
+		if _, err := e.w.Seek(u.pos, io.SeekStart); err != nil {
+			return err
+		}
+
+		if err := binary.Write(e.w, binary.BigEndian, u.value); err != nil {
+			return err
+		}
+	}
+
+	_, err := e.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// pascalString encodes s as a count byte followed by the text, padded to an even length.
+func pascalString(s string) []byte {
+	p := append([]byte{byte(len(s))}, s...)
+	if len(p)%2 == 1 {
+		p = append(p, 0x00)
+	}
+
+	return p
+}
@@ -0,0 +1,94 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+)
+
+// Encoding is the sample format of a rendered file.
+type Encoding int
+
+const (
+	// Int32 is 32-bit integer PCM. This is the default encoding.
+	Int32 Encoding = iota
+	// Int16 is 16-bit integer PCM.
+	Int16
+	// Int24 is 24-bit integer PCM.
+	Int24
+	// Float32 is 32-bit IEEE floating point.
+	Float32
+	// Float64 is 64-bit IEEE floating point.
+	Float64
+)
+
+// BitDepth returns the number of bits a single sample occupies.
+func (e Encoding) BitDepth() int {
+	switch e {
+	case Int16:
+		return 16
+
+	case Int24:
+		return 24
+
+	case Float64:
+		return 64
+
+	default:
+		return 32
+	}
+}
+
+// IsFloat reports whether the encoding is an IEEE floating point one.
+func (e Encoding) IsFloat() bool {
+	return e == Float32 || e == Float64
+}
+
+// encodeSamples appends the samples to buf in the given byte order and encoding.
+// Integer encodings are scaled, optionally dithered and clipped to their range.
+func encodeSamples(buf *bytes.Buffer, order binary.ByteOrder, encoding Encoding, dither *rand.Rand, samples []float64) {
+	size := encoding.BitDepth() / 8
+	b := make([]byte, len(samples)*size)
+
+	max := math.Pow(2, float64(encoding.BitDepth()-1)) - 1
+	for n, v := range samples {
+		out := b[n*size : (n+1)*size]
+
+		switch encoding {
+		case Float32:
+			order.PutUint32(out, math.Float32bits(float32(v)))
+			continue
+
+		case Float64:
+			order.PutUint64(out, math.Float64bits(v))
+			continue
+		}
+
+		v *= max
+		if dither != nil {
+			// Triangular probability density function dither of one LSB peak.
+			v += dither.Float64() - dither.Float64()
+		}
+
+		v = math.Round(math.Max(-max, math.Min(max, v)))
+
+		switch encoding {
+		case Int16:
+			order.PutUint16(out, uint16(int16(v)))
+
+		case Int24:
+			i := int32(v)
+			if order == binary.BigEndian {
+				out[0], out[1], out[2] = byte(i>>16), byte(i>>8), byte(i)
+			} else {
+				out[0], out[1], out[2] = byte(i), byte(i>>8), byte(i>>16)
+			}
+
+		default:
+			order.PutUint32(out, uint32(int32(v)))
+		}
+	}
+
+	buf.Write(b)
+}
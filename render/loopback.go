@@ -0,0 +1,183 @@
+package render
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bh90210/mlsic"
+)
+
+// ErrStreamStopped is returned when stopping or aborting a loopback stream that is not playing.
+var ErrStreamStopped = errors.New("stream is stopped")
+
+// Loopback is a simulated output device. Streams are played to it in real time,
+// one buffer of frames every buffer's duration, and the played frames are
+// captured instead of being sent to a sound card.
+type Loopback struct {
+	// Capture receives the played interleaved frames. If not set they are kept in memory.
+	Capture mlsic.Writer
+
+	mu     sync.Mutex
+	frames mlsic.Audio
+	err    error
+}
+
+// NewLoopback returns a PortAudio renderer playing to device instead of a PortAudio device.
+// It has the same defaults as NewPortAudio and does not initialize PortAudio.
+// Built with the noportaudio tag it does not need PortAudio or cgo at all.
+func NewLoopback(device *Loopback, opts ...PortAudioOption) *PortAudio {
+	pa := &PortAudio{
+		BufferSize: bufferSize,
+		Latency:    10 * time.Millisecond,
+		Channels:   2,
+		SampleRate: mlsic.SampleRate,
+		loopback:   device,
+	}
+
+	for _, opt := range opts {
+		opt(pa)
+	}
+
+	return pa
+}
+
+// Frames returns the interleaved frames played so far when no Capture is set.
+// Silence played while no frames were available is included.
+func (l *Loopback) Frames() mlsic.Audio {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append(mlsic.Audio(nil), l.frames...)
+}
+
+// Err returns the first error returned by Capture, if any.
+func (l *Loopback) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.err
+}
+
+// capture records a buffer of played frames.
+func (l *Loopback) capture(out []float32) {
+	frames := make(mlsic.Audio, len(out))
+	for i, v := range out {
+		frames[i] = float64(v)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.Capture == nil {
+		l.frames = append(l.frames, frames...)
+		return
+	}
+
+	if l.err != nil {
+		return
+	}
+
+	_, l.err = l.Capture.Write(frames)
+}
+
+func (l *Loopback) open(parameters streamParameters, callback func([]float32, streamTimeInfo)) *loopbackStream {
+	return &loopbackStream{
+		device:   l,
+		callback: callback,
+		out:      make([]float32, parameters.FramesPerBuffer*parameters.Output.Channels),
+		period:   mlsic.SamplesInDuration(parameters.FramesPerBuffer, int(parameters.SampleRate)),
+		latency:  parameters.Output.Latency,
+		created:  time.Now(),
+	}
+}
+
+// loopbackStream implements outputStream calling back for a buffer of frames every period.
+type loopbackStream struct {
+	device   *Loopback
+	callback func([]float32, streamTimeInfo)
+	out      []float32
+	period   time.Duration
+	latency  time.Duration
+	// created is the start of the stream's time.
+	created time.Time
+
+	stop chan struct{}
+	done chan struct{}
+	// last is the output time of the last buffer handed to the device.
+	last time.Duration
+}
+
+// Start implements outputStream.
+func (s *loopbackStream) Start() error {
+	if s.stop != nil {
+		return errors.New("stream is already playing")
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go s.play()
+
+	return nil
+}
+
+func (s *loopbackStream) play() {
+	defer close(s.done)
+
+	start := s.Time()
+	for buffer := 0; ; buffer++ {
+		// The time the buffer is due.
+		due := start + time.Duration(buffer)*s.period
+
+		select {
+		case <-s.stop:
+			return
+
+		case <-time.After(due - s.Time()):
+		}
+
+		s.callback(s.out, streamTimeInfo{
+			CurrentTime:         s.Time(),
+			OutputBufferDacTime: due + s.latency,
+		})
+
+		s.device.capture(s.out)
+		s.last = due + s.latency
+	}
+}
+
+// Stop implements outputStream. It waits until the buffers handed to the device have been played.
+func (s *loopbackStream) Stop() error {
+	if err := s.Abort(); err != nil {
+		return err
+	}
+
+	time.Sleep(s.last + s.period - s.Time())
+
+	return nil
+}
+
+// Abort implements outputStream.
+func (s *loopbackStream) Abort() error {
+	if s.stop == nil {
+		return ErrStreamStopped
+	}
+
+	close(s.stop)
+	<-s.done
+
+	s.stop = nil
+
+	return nil
+}
+
+// Close implements outputStream.
+func (s *loopbackStream) Close() error {
+	return nil
+}
+
+// Time implements outputStream.
+func (s *loopbackStream) Time() time.Duration {
+	return time.Since(s.created)
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bh90210/mlsic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoopback(t *testing.T) {
+	a := assert.New(t)
+
+	device := &Loopback{}
+	p := NewLoopback(device, WithBufferSize(256), WithLatency(20*time.Millisecond), WithSampleRate(8000))
+
+	// Two tenths of a second.
+	signal := []mlsic.Audio{make(mlsic.Audio, 1600), make(mlsic.Audio, 1600)}
+	for i := range signal[0] {
+		signal[0][i] = float64(i+1) / 1600
+		signal[1][i] = -float64(i+1) / 1600
+	}
+
+	start := time.Now()
+	a.NoError(p.Render(signal, ""))
+	elapsed := time.Since(start)
+
+	// Rendering takes as long as playing the signal, plus the latency of the device.
+	a.GreaterOrEqual(elapsed, 220*time.Millisecond)
+	a.Less(elapsed, 400*time.Millisecond)
+
+	frames := device.Frames()
+	a.Zero(len(frames) % (256 * 2))
+
+	// No silence is played before the signal, and only silence after it.
+	want := mlsic.Interleave(signal)
+	for i, v := range want {
+		a.InDelta(v, frames[i], 1e-6)
+	}
+
+	for _, v := range frames[len(want):] {
+		a.Zero(v)
+	}
+
+	// The renderer can be reused.
+	a.NoError(p.Render(signal, ""))
+	a.Greater(len(device.Frames()), len(frames))
+	a.NoError(p.Close())
+}
+
+func TestLoopbackCancel(t *testing.T) {
+	a := assert.New(t)
+
+	device := &Loopback{}
+	p := NewLoopback(device, WithBufferSize(64))
+
+	// One minute of silence.
+	signal := []mlsic.Audio{make(mlsic.Audio, 60*mlsic.SampleRate), make(mlsic.Audio, 60*mlsic.SampleRate)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Stream(ctx, mlsic.NewAudioReader(signal))
+	a.ErrorIs(err, context.DeadlineExceeded)
+	a.Less(time.Since(start), time.Second)
+}
+
+func TestLoopbackCapture(t *testing.T) {
+	a := assert.New(t)
+
+	filePath := t.TempDir()
+
+	w := Wav{Filepath: filePath, Encoding: Float32}
+	capture, err := w.NewWriter("capture", 1)
+	a.NoError(err)
+
+	device := &Loopback{Capture: capture}
+	p := NewLoopback(device, WithChannels(1), WithBufferSize(128), WithSampleRate(16000))
+
+	a.NoError(p.Render([]mlsic.Audio{{0.5, 0.25, -0.25, -0.5}}, ""))
+	a.NoError(device.Err())
+	a.NoError(capture.Close())
+
+	_, channels, _, samples := readWave(t, filepath.Join(filePath, "capture.wav"), Float32)
+	a.Equal(1, channels)
+	a.Zero(len(samples) % 128)
+	a.Equal([]float64{0.5, 0.25, -0.25, -0.5}, samples[:4])
+}
+
+func TestLoopbackRouting(t *testing.T) {
+	a := assert.New(t)
+
+	// One channel sent to the second and the fourth output.
+	device := &Loopback{}
+	p := NewLoopback(device, WithChannels(4), WithBufferSize(16), WithRouting(Routing{{0, 1, 0, 0.5}}))
+
+	a.NoError(p.Render([]mlsic.Audio{{1, -1}}, ""))
+	a.Equal(mlsic.Audio{0, 1, 0, 0.5, 0, -1, 0, -0.5}, device.Frames()[:8])
+
+	// Four channels folded down to two outputs.
+	device = &Loopback{}
+	p = NewLoopback(device, WithBufferSize(16))
+
+	a.NoError(p.Render([]mlsic.Audio{{1}, {1}, {1}, {1}}, ""))
+
+	frames := device.Frames()
+	a.InDelta(1, frames[0], 1e-6)
+	a.InDelta(1, frames[1], 1e-6)
+
+	// Fewer channels than outputs leaves the rest silent.
+	device = &Loopback{}
+	p = NewLoopback(device, WithChannels(3), WithBufferSize(16))
+
+	a.NoError(p.Render([]mlsic.Audio{{0.5}, {0.25}}, ""))
+	a.Equal(mlsic.Audio{0.5, 0.25, 0}, device.Frames()[:3])
+
+	// A routing not matching the channels is rejected.
+	p = NewLoopback(&Loopback{}, WithRouting(Routing{{1, 0}}))
+	a.ErrorIs(p.Render([]mlsic.Audio{{1}, {1}}, ""), ErrRouting)
+
+	p = NewLoopback(&Loopback{}, WithChannels(3), WithRouting(Routing{{1, 0}}))
+	a.ErrorIs(p.Render([]mlsic.Audio{{1}}, ""), ErrRouting)
+}
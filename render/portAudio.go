@@ -1,15 +1,31 @@
 // Package render holds three mlsic.Renderer implementations (Wav, Aiff and PortAudio.)
+// PortAudio can also play to a Loopback device for testing real-time rendering without a sound card.
+//
+// PortAudio is linked through cgo. Building with the noportaudio tag leaves it out,
+// NewPortAudio then returns ErrNoPortAudio while Loopback keeps working.
 package render
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bh90210/mlsic"
-	"github.com/gordonklaus/portaudio"
 )
 
 const bufferSize int = 512
 
+// ErrClosed is returned when writing to or closing an already closed Writer.
+var ErrClosed = errors.New("writer is closed")
+
+// ErrAborted is returned when writing to or closing a PortAudioWriter whose playback was aborted.
+var ErrAborted = errors.New("playback aborted")
+
+// ErrNoPortAudio is returned by NewPortAudio and NewWriter in builds tagged noportaudio.
+var ErrNoPortAudio = errors.New("built without PortAudio")
+
 var _ mlsic.Renderer = (*PortAudio)(nil)
 
 // PortAudio implements mlsic.Renderer and holds all
@@ -18,16 +34,36 @@ type PortAudio struct {
 	// Latency is part of the portaudio.StreamDeviceParameters.
 	Latency time.Duration
 	// OutputDevice is the device to be used.
-	OutputDevice *portaudio.DeviceInfo
+	OutputDevice *DeviceInfo
 	// BufferSize is part of the portaudio.StreamDeviceParameters.
 	BufferSize int
-	Channels   int
+	// Channels is the number of outputs of the device to play to.
+	Channels int
+	// SampleRate is part of the portaudio.StreamParameters.
+	SampleRate int
+	// Routing maps the channels of the source to the outputs of the device.
+	// If not set DefaultRouting is used.
+	Routing Routing
+
+	// loopback, if set, is the device streams are played to instead of PortAudio's.
+	loopback *Loopback
+}
+
+// outputStream is the part of portaudio.Stream used for playback.
+type outputStream interface {
+	Start() error
+	Stop() error
+	Abort() error
+	Close() error
+	Time() time.Duration
 }
 
 // NewPortAudio will try to initialize with a portaudio.DefaultOutputDevice()
-// with the default buffer size set at 512, latency 10ms and 2 channels.
+// with the default buffer size set at 512, latency 10ms, 2 channels and
+// mlsic.SampleRate sampling rate. The returned renderer can be used for any
+// number of renders and must be closed when no longer needed.
 func NewPortAudio(opts ...PortAudioOption) (pa *PortAudio, err error) {
-	err = portaudio.Initialize()
+	err = initialize()
 	if err != nil {
 		return
 	}
@@ -35,8 +71,9 @@ func NewPortAudio(opts ...PortAudioOption) (pa *PortAudio, err error) {
 	// Set default values to the named return value pa.
 	pa = &PortAudio{
 		BufferSize: bufferSize,
-		Latency:    10,
+		Latency:    10 * time.Millisecond,
 		Channels:   2,
+		SampleRate: mlsic.SampleRate,
 	}
 
 	for _, opt := range opts {
@@ -44,10 +81,11 @@ func NewPortAudio(opts ...PortAudioOption) (pa *PortAudio, err error) {
 	}
 
 	if pa.OutputDevice == nil {
-		var defaultOutput *portaudio.DeviceInfo
-		defaultOutput, err = portaudio.DefaultOutputDevice()
+		var defaultOutput *DeviceInfo
+		defaultOutput, err = defaultOutputDevice()
 		if err != nil {
-			return
+			terminate()
+			return nil, err
 		}
 
 		pa.OutputDevice = defaultOutput
@@ -56,63 +94,396 @@ func NewPortAudio(opts ...PortAudioOption) (pa *PortAudio, err error) {
 	return
 }
 
-// Render will render for as many channels as len(pcmBuffer).
-func (p *PortAudio) Render(a []mlsic.Audio, _ string) error {
-	defer portaudio.Terminate()
+// Render plays source through the output device, returning once its last frame has been played.
+// It is the same as calling Stream with a mlsic.AudioReader of source.
+// Each mlsic.Audio of source is routed to the outputs of the device according to Routing.
+func (p *PortAudio) Render(source []mlsic.Audio, _ string) error {
+	return p.Stream(context.Background(), mlsic.NewAudioReader(source))
+}
 
-	parameters := portaudio.StreamParameters{
-		Input: portaudio.StreamDeviceParameters{
-			Device: nil,
-		},
+// Stream plays the interleaved frames of r through the output device until r returns io.EOF.
+// It returns once the last frame has been played, or as soon as ctx is done
+// in which case playback stops immediately and the context's error is returned.
+//
+// If r has a Channels() int method, like mlsic.AudioReader does, it gives the number of
+// channels of r. Otherwise r is expected to have as many channels as the rows of Routing
+// if set, or as the device's outputs if not.
+func (p *PortAudio) Stream(ctx context.Context, r mlsic.Reader) error {
+	channels := p.Channels
+	if p.Routing != nil {
+		channels = len(p.Routing)
+	}
+
+	if c, ok := r.(interface{ Channels() int }); ok {
+		channels = c.Channels()
+	}
+
+	w, err := p.NewWriter(channels)
+	if err != nil {
+		return err
+	}
+
+	stop := context.AfterFunc(ctx, w.cancel)
+	defer stop()
+
+	_, err = mlsic.Copy(w, r)
+	if err == nil {
+		err = w.Close()
+	}
 
-		Output: portaudio.StreamDeviceParameters{
+	if err != nil {
+		w.Abort()
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Close terminates PortAudio. The renderer can not be used after it is closed.
+func (p *PortAudio) Close() error {
+	if p.loopback != nil {
+		return nil
+	}
+
+	return terminate()
+}
+
+var _ mlsic.Writer = (*PortAudioWriter)(nil)
+
+// PortAudioWriter implements mlsic.Writer playing the written frames
+// through a callback driven PortAudio stream.
+type PortAudioWriter struct {
+	stream     outputStream
+	started    bool
+	channels   int
+	outputs    int
+	bufferSize int
+	sampleRate int
+	// routing is nil when channels are played unchanged to the outputs.
+	routing Routing
+
+	// buffers passes BufferSize frames at a time to the callback.
+	buffers chan []float32
+	// pending holds the written samples not yet sent to the callback.
+	pending []float32
+	// current is the buffer being played by the callback.
+	current []float32
+	// drained is set by the callback once buffers is closed and emptied.
+	// Like current it is only used by the callback.
+	drained bool
+	// done is closed by the callback once the last written frame has been handed to the stream.
+	done chan struct{}
+	// end is the stream time the last written frame will be played at.
+	end time.Duration
+	// aborted is closed to interrupt a blocked Write or Close.
+	aborted    chan struct{}
+	cancelOnce sync.Once
+	closed     atomic.Bool
+	// mu keeps Abort from closing the stream while it is being used.
+	mu sync.Mutex
+}
+
+// NewWriter opens a callback stream on the output device and returns a Writer
+// playing interleaved frames of the given number of channels, routed to the
+// outputs of the device according to Routing. The stream starts once enough
+// frames have been written to keep it busy for a few buffers, or on Close.
+// Write blocks while the stream is busy playing previously written frames.
+// If frames are not written fast enough silence is played in their place.
+func (p *PortAudio) NewWriter(channels int) (*PortAudioWriter, error) {
+	w, err := p.newWriter(channels)
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := streamParameters{
+		Output: streamDeviceParameters{
 			Device:   p.OutputDevice,
 			Channels: p.Channels,
 			Latency:  p.Latency,
 		},
 
-		SampleRate:      float64(44100),
+		SampleRate:      float64(p.SampleRate),
 		FramesPerBuffer: p.BufferSize,
 	}
 
-	var buffers [][]float32
-	for _, v := range a {
-		data32 := make([]float32, len(v))
-		f64ToF32Copy(data32, v)
-		buffers = append(buffers, data32)
+	var stream outputStream
+	if p.loopback != nil {
+		stream = p.loopback.open(parameters, w.callback)
+	} else {
+		var err error
+		stream, err = openStream(parameters, w.callback)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	stream, err := portaudio.OpenStream(parameters, buffers)
-	if err != nil {
-		return err
+	w.stream = stream
+
+	return w, nil
+}
+
+// newWriter returns a PortAudioWriter without a stream.
+func (p *PortAudio) newWriter(channels int) (*PortAudioWriter, error) {
+	if channels < 1 {
+		return nil, mlsic.ErrFrameAlignment
+	}
+
+	routing := p.Routing
+	if routing == nil && channels != p.Channels {
+		routing = DefaultRouting(channels, p.Channels)
 	}
 
-	defer stream.Stop()
+	if routing != nil {
+		if err := routing.validate(channels, p.Channels); err != nil {
+			return nil, err
+		}
+	}
 
-	finish, startCounting := make(chan bool), make(chan bool, 1)
-	// Calculate when to stop based on buffers length.
-	go func() {
-		length := len(buffers[0])
-		<-startCounting
-		time.Sleep(time.Duration(length/int(parameters.SampleRate)) * time.Second)
-		finish <- true
-	}()
+	return &PortAudioWriter{
+		channels:   channels,
+		outputs:    p.Channels,
+		routing:    routing,
+		bufferSize: p.BufferSize,
+		sampleRate: p.SampleRate,
+		// Keep a few buffers ahead of the stream.
+		buffers: make(chan []float32, 4),
+		done:    make(chan struct{}),
+		aborted: make(chan struct{}),
+	}, nil
+}
 
-	err = stream.Start()
-	if err != nil {
+// callback fills out with the written frames, or silence if there are none available.
+func (w *PortAudioWriter) callback(out []float32, timeInfo streamTimeInfo) {
+	length := len(out)
+
+	if w.drained {
+		clear(out)
+		return
+	}
+
+	for len(out) > 0 {
+		if len(w.current) == 0 {
+			select {
+			case buf, ok := <-w.buffers:
+				if !ok {
+					// The frames copied so far are the last ones.
+					frames := (length - len(out)) / w.outputs
+					w.end = timeInfo.OutputBufferDacTime + mlsic.SamplesInDuration(frames, w.sampleRate)
+
+					w.drained = true
+					close(w.done)
+
+					clear(out)
+					return
+				}
+
+				w.current = buf
+
+			default:
+				// Underflow.
+				clear(out)
+				return
+			}
+		}
+
+		n := copy(out, w.current)
+		out = out[n:]
+		w.current = w.current[n:]
+	}
+}
+
+// Write implements mlsic.Writer.
+func (w *PortAudioWriter) Write(p mlsic.Audio) (int, error) {
+	if w.closed.Load() {
+		return 0, ErrClosed
+	}
+
+	if len(p)%w.channels != 0 {
+		return 0, mlsic.ErrFrameAlignment
+	}
+
+	if w.routing == nil {
+		for _, v := range p {
+			w.pending = append(w.pending, float32(v))
+		}
+	} else {
+		w.pending = w.routing.route(w.pending, p, w.outputs)
+	}
+
+	size := w.bufferSize * w.outputs
+	for len(w.pending) >= size {
+		buf := make([]float32, size)
+		copy(buf, w.pending)
+
+		// A select picks any ready case, so check first that
+		// playback was not aborted while the buffer has room.
+		if w.isAborted() {
+			return 0, ErrAborted
+		}
+
+		select {
+		case w.buffers <- buf:
+		case <-w.aborted:
+			return 0, ErrAborted
+		}
+
+		w.pending = w.pending[:copy(w.pending, w.pending[size:])]
+
+		// Start playing once the stream has enough frames to play.
+		if len(w.buffers) == cap(w.buffers) {
+			if err := w.start(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+// Close plays any remaining frames and returns exactly when the last one
+// has been played, before closing the stream.
+func (w *PortAudioWriter) Close() error {
+	if w.closed.Load() {
+		return ErrClosed
+	}
+
+	if w.isAborted() {
+		return ErrAborted
+	}
+
+	if len(w.pending) > 0 {
+		select {
+		case w.buffers <- w.pending:
+		case <-w.aborted:
+			return ErrAborted
+		}
+
+		w.pending = nil
+	}
+
+	if err := w.start(); err != nil {
 		return err
 	}
 
-	startCounting <- true
+	w.closed.Store(true)
+	close(w.buffers)
+
+	select {
+	case <-w.done:
+	case <-w.aborted:
+		return ErrAborted
+	}
+
+	w.mu.Lock()
+	if w.stream == nil {
+		w.mu.Unlock()
+		return ErrAborted
+	}
+
+	// Hosts not reporting the output time leave the end at zero. In that case
+	// Stop waits for the remaining buffers to be played instead.
+	if w.end == 0 {
+		defer w.mu.Unlock()
+		return w.closeStream(w.stream.Stop())
+	}
+
+	wait := w.end - w.stream.Time()
+	w.mu.Unlock()
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-w.aborted:
+			timer.Stop()
+			return ErrAborted
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stream == nil {
+		return ErrAborted
+	}
+
+	// Only silence is left in the stream so there is no need to wait for it.
+	return w.closeStream(w.stream.Abort())
+}
+
+// start starts the stream, if not already started. It returns ErrAborted
+// if playback was aborted, as the stream may already be gone.
+func (w *PortAudioWriter) start() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.isAborted() || w.stream == nil {
+		return ErrAborted
+	}
+
+	if w.started {
+		return nil
+	}
+
+	w.started = true
+
+	return w.stream.Start()
+}
+
+// Abort stops playback immediately, discarding any frames not yet played, and closes the stream.
+func (w *PortAudioWriter) Abort() error {
+	w.cancel()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.stream == nil {
+		return ErrClosed
+	}
+
+	if !w.started {
+		return w.closeStream(nil)
+	}
+
+	return w.closeStream(w.stream.Abort())
+}
+
+// cancel interrupts a blocked Write or Close. It is safe to call concurrently.
+func (w *PortAudioWriter) cancel() {
+	w.cancelOnce.Do(func() {
+		close(w.aborted)
+	})
+}
+
+// isAborted reports, without blocking, whether playback was aborted.
+func (w *PortAudioWriter) isAborted() bool {
+	select {
+	case <-w.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeStream closes the stream returning err, if any, or the error closing it.
+// It is called with mu held.
+func (w *PortAudioWriter) closeStream(err error) error {
+	w.closed.Store(true)
+
+	closeErr := w.stream.Close()
+	w.stream = nil
 
-	err = stream.Write()
 	if err != nil {
 		return err
 	}
 
-	<-finish
-
-	return nil
+	return closeErr
 }
 
 // PortAudioOption if a custom type function that accepts *PortAudio
@@ -127,7 +498,7 @@ func WithBufferSize(customSize int) PortAudioOption {
 }
 
 // WithOutputDevice set custom output device.
-func WithOutputDevice(device *portaudio.DeviceInfo) PortAudioOption {
+func WithOutputDevice(device *DeviceInfo) PortAudioOption {
 	return func(s *PortAudio) {
 		s.OutputDevice = device
 	}
@@ -140,17 +511,23 @@ func WithLatency(latency time.Duration) PortAudioOption {
 	}
 }
 
-// WithChannels sets PortAudio's number of channels.
+// WithChannels sets PortAudio's number of device outputs.
 func WithChannels(no int) PortAudioOption {
 	return func(s *PortAudio) {
 		s.Channels = no
 	}
 }
 
-// portaudio doesn't support float64 so we need to copy our data over to the
-// destination buffer.
-func f64ToF32Copy(dst []float32, src []float64) {
-	for i := range src {
-		dst[i] = float32(src[i])
+// WithRouting sets how the channels of the source are routed to the outputs of the device.
+func WithRouting(routing Routing) PortAudioOption {
+	return func(s *PortAudio) {
+		s.Routing = routing
+	}
+}
+
+// WithSampleRate sets PortAudio's sample rate.
+func WithSampleRate(sampleRate int) PortAudioOption {
+	return func(s *PortAudio) {
+		s.SampleRate = sampleRate
 	}
 }
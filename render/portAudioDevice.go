@@ -0,0 +1,35 @@
+//go:build !noportaudio
+
+package render
+
+import "github.com/gordonklaus/portaudio"
+
+// DeviceInfo describes a PortAudio device.
+type DeviceInfo = portaudio.DeviceInfo
+
+type (
+	streamParameters       = portaudio.StreamParameters
+	streamDeviceParameters = portaudio.StreamDeviceParameters
+	streamTimeInfo         = portaudio.StreamCallbackTimeInfo
+)
+
+func initialize() error {
+	return portaudio.Initialize()
+}
+
+func terminate() error {
+	return portaudio.Terminate()
+}
+
+func defaultOutputDevice() (*DeviceInfo, error) {
+	return portaudio.DefaultOutputDevice()
+}
+
+func openStream(parameters streamParameters, callback func([]float32, streamTimeInfo)) (outputStream, error) {
+	stream, err := portaudio.OpenStream(parameters, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
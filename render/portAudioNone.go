@@ -0,0 +1,45 @@
+//go:build noportaudio
+
+package render
+
+import "time"
+
+// DeviceInfo describes a PortAudio device. Builds tagged noportaudio have no
+// devices, only the fields of PortAudio's DeviceInfo used for playback are kept.
+type DeviceInfo struct {
+	Name              string
+	MaxOutputChannels int
+	DefaultSampleRate float64
+}
+
+type streamParameters struct {
+	Output          streamDeviceParameters
+	SampleRate      float64
+	FramesPerBuffer int
+}
+
+type streamDeviceParameters struct {
+	Device   *DeviceInfo
+	Channels int
+	Latency  time.Duration
+}
+
+type streamTimeInfo struct {
+	InputBufferAdcTime, CurrentTime, OutputBufferDacTime time.Duration
+}
+
+func initialize() error {
+	return ErrNoPortAudio
+}
+
+func terminate() error {
+	return nil
+}
+
+func defaultOutputDevice() (*DeviceInfo, error) {
+	return nil, ErrNoPortAudio
+}
+
+func openStream(streamParameters, func([]float32, streamTimeInfo)) (outputStream, error) {
+	return nil, ErrNoPortAudio
+}
@@ -0,0 +1,19 @@
+//go:build noportaudio
+
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoPortAudio(t *testing.T) {
+	a := assert.New(t)
+
+	_, err := NewPortAudio()
+	a.ErrorIs(err, ErrNoPortAudio)
+
+	_, err = (&PortAudio{BufferSize: bufferSize, Channels: 2}).NewWriter(2)
+	a.ErrorIs(err, ErrNoPortAudio)
+}
@@ -0,0 +1,80 @@
+package render
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bh90210/mlsic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPortAudioWriterCallback(t *testing.T) {
+	a := assert.New(t)
+
+	p := PortAudio{
+		BufferSize: 4,
+		Channels:   2,
+		SampleRate: mlsic.SampleRate,
+	}
+
+	w, err := p.newWriter(2)
+	a.NoError(err)
+
+	// Nothing written yet plays silence.
+	out := []float32{1, 1, 1, 1, 1, 1, 1, 1}
+	w.callback(out, streamTimeInfo{})
+	a.Equal(make([]float32, 8), out)
+
+	frames := make(mlsic.Audio, 2*6)
+	for i := range frames {
+		frames[i] = float64(i + 1)
+	}
+
+	n, err := w.Write(frames)
+	a.NoError(err)
+	a.Equal(12, n)
+
+	_, err = w.Write(mlsic.Audio{1})
+	a.ErrorIs(err, mlsic.ErrFrameAlignment)
+
+	// Hand over the remaining frames as Close does.
+	w.buffers <- w.pending
+	close(w.buffers)
+
+	w.callback(out, streamTimeInfo{OutputBufferDacTime: time.Second})
+	a.Equal([]float32{1, 2, 3, 4, 5, 6, 7, 8}, out)
+
+	w.callback(out, streamTimeInfo{OutputBufferDacTime: 2 * time.Second})
+	a.Equal([]float32{9, 10, 11, 12, 0, 0, 0, 0}, out)
+
+	select {
+	case <-w.done:
+	default:
+		a.Fail("last frame not signaled")
+	}
+
+	// The last frame plays two frames after the start of the buffer.
+	a.Equal(2*time.Second+mlsic.SamplesInDuration(2, mlsic.SampleRate), w.end)
+
+	// Once drained the callback plays silence, leaving the end and the writer's channels as they are.
+	out = []float32{1, 1, 1, 1, 1, 1, 1, 1}
+	w.callback(out, streamTimeInfo{OutputBufferDacTime: 3 * time.Second})
+	a.Equal(make([]float32, 8), out)
+	a.Equal(2*time.Second+mlsic.SamplesInDuration(2, mlsic.SampleRate), w.end)
+	a.NotNil(w.buffers)
+
+	// A Write blocked on a busy stream returns once aborted.
+	w, err = p.newWriter(2)
+	a.NoError(err)
+	w.cancel()
+	w.cancel()
+
+	_, err = w.Write(make(mlsic.Audio, 8*(cap(w.buffers)+1)))
+	a.ErrorIs(err, ErrAborted)
+
+	// Even if the buffers had room, an aborted stream is never started.
+	_, err = w.Write(make(mlsic.Audio, 8*cap(w.buffers)))
+	a.ErrorIs(err, ErrAborted)
+	a.ErrorIs(w.start(), ErrAborted)
+	a.ErrorIs(w.Close(), ErrAborted)
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"errors"
+	"math"
+
+	"github.com/bh90210/mlsic"
+)
+
+// ErrRouting is returned when a Routing does not match the number of channels or outputs.
+var ErrRouting = errors.New("routing does not match the number of channels and outputs")
+
+// Routing maps the channels of a source to the outputs of a device.
+// Routing[c][o] is the gain channel c is played with on output o,
+// so a channel can be sent to any number of outputs.
+type Routing [][]float64
+
+// DirectRouting sends each channel to the output of the same number.
+// Outputs without a channel are silent and channels without an output are dropped.
+func DirectRouting(channels, outputs int) Routing {
+	routing := make(Routing, channels)
+	for c := range routing {
+		routing[c] = make([]float64, outputs)
+		if c < outputs {
+			routing[c][c] = 1
+		}
+	}
+
+	return routing
+}
+
+// FoldDownRouting spreads the channels across the outputs as if the channels were speakers
+// placed evenly from left to right, each one panned to the outputs with mlsic.Panning.
+// Gains are scaled so that no output exceeds full scale when all channels are at full scale.
+func FoldDownRouting(channels, outputs int) Routing {
+	routing := make(Routing, channels)
+	sums := make([]float64, outputs)
+
+	for c := range routing {
+		routing[c] = make([]float64, outputs)
+
+		// The middle of the channel's width.
+		position := (float64(c) + 0.5) / float64(channels)
+		for o := range routing[c] {
+			routing[c][o] = mlsic.Panning(outputs, o, position)
+			sums[o] += routing[c][o]
+		}
+	}
+
+	var max float64
+	for _, sum := range sums {
+		max = math.Max(max, sum)
+	}
+
+	if max > 1 {
+		for c := range routing {
+			for o := range routing[c] {
+				routing[c][o] /= max
+			}
+		}
+	}
+
+	return routing
+}
+
+// DefaultRouting returns DirectRouting if there are at least as many outputs as channels,
+// padding the extra outputs with silence, or FoldDownRouting if there are fewer.
+func DefaultRouting(channels, outputs int) Routing {
+	if channels > outputs {
+		return FoldDownRouting(channels, outputs)
+	}
+
+	return DirectRouting(channels, outputs)
+}
+
+func (r Routing) validate(channels, outputs int) error {
+	if len(r) != channels {
+		return ErrRouting
+	}
+
+	for _, gains := range r {
+		if len(gains) != outputs {
+			return ErrRouting
+		}
+	}
+
+	return nil
+}
+
+// route appends the interleaved frames of src, routed to the given number of outputs, to dst.
+func (r Routing) route(dst []float32, src mlsic.Audio, outputs int) []float32 {
+	channels := len(r)
+
+	for i := 0; i+channels <= len(src); i += channels {
+		frame := src[i : i+channels]
+
+		for o := 0; o < outputs; o++ {
+			var v float64
+			for c, s := range frame {
+				v += s * r[c][o]
+			}
+
+			dst = append(dst, float32(v))
+		}
+	}
+
+	return dst
+}
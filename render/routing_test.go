@@ -0,0 +1,65 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/bh90210/mlsic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectRouting(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(Routing{{1, 0, 0}, {0, 1, 0}}, DirectRouting(2, 3))
+	a.Equal(Routing{{1}, {0}}, DirectRouting(2, 1))
+
+	a.Equal(DirectRouting(2, 4), DefaultRouting(2, 4))
+	a.Equal(FoldDownRouting(8, 2), DefaultRouting(8, 2))
+}
+
+func TestFoldDownRouting(t *testing.T) {
+	a := assert.New(t)
+
+	routing := FoldDownRouting(8, 2)
+	a.Len(routing, 8)
+
+	var left, right float64
+	for c, gains := range routing {
+		a.Len(gains, 2)
+
+		// Mirrored channels are mirrored on the outputs.
+		a.InDelta(gains[0], routing[7-c][1], 1e-9)
+
+		left += gains[0]
+		right += gains[1]
+	}
+
+	// Left channels lean left.
+	a.Greater(routing[0][0], routing[0][1])
+	a.Greater(routing[7][1], routing[7][0])
+
+	// All channels at full scale do not clip.
+	a.InDelta(1, left, 1e-9)
+	a.InDelta(1, right, 1e-9)
+
+	a.Equal(Routing{{0.5}, {0.5}}, FoldDownRouting(2, 1))
+
+	// A single channel sits in the middle, between the second and third of four outputs.
+	a.Equal(Routing{{0, 0.5, 0.5, 0}}, FoldDownRouting(1, 4))
+}
+
+func TestRoute(t *testing.T) {
+	a := assert.New(t)
+
+	routing := Routing{
+		{1, 0, 0.5},
+		{0, 1, 0.5},
+	}
+
+	a.NoError(routing.validate(2, 3))
+	a.ErrorIs(routing.validate(3, 3), ErrRouting)
+	a.ErrorIs(routing.validate(2, 2), ErrRouting)
+
+	got := routing.route(nil, mlsic.Audio{1, 0.5, -1, 0}, 3)
+	a.Equal([]float32{1, 0.5, 0.75, -1, 0, -0.5}, got)
+}
@@ -1,7 +1,10 @@
 package render
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sync"
@@ -9,8 +12,6 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"github.com/bh90210/mlsic"
-	"github.com/go-audio/audio"
-	"github.com/go-audio/transforms"
 	"github.com/go-audio/wav"
 )
 
@@ -22,122 +23,325 @@ type Wav struct {
 	Filepath string
 	// Meta holds .wav file metadata.
 	Meta *wav.Metadata
+	// SampleRate of the resulting files. If not set mlsic.SampleRate is used.
+	SampleRate int
+	// Interleaved renders all channels in a single multichannel WAVE_FORMAT_EXTENSIBLE
+	// file instead of one mono file per channel.
+	Interleaved bool
+	// ChannelMask is the speaker positions mask of interleaved files.
+	// If not set DefaultChannelMask is used.
+	ChannelMask uint32
+	// Encoding is the sample format of the resulting files. Default is Int32.
+	Encoding Encoding
+	// Dither adds triangular dither before quantizing to integer encodings.
+	// It is recommended when rendering Int16 files.
+	Dither bool
 }
 
 // Render accepts a slice of audio.PCMBuffer and creates out of each one of them a mono
 // .wav file named /path/to/file/0.wav for the first channel, /path/to/file/1.wav for the second etc.
 // If a filename is provided then the resulting file is /path/to/file/name0.wav.
+//
+// If Interleaved is set a single file named /path/to/file/name.wav is created instead,
+// or /path/to/file/interleaved.wav if no name is provided.
 func (w *Wav) Render(source []mlsic.Audio, name string) error {
+	files := w.files(w.Interleaved)
+	return files.render(source, name)
+}
+
+// NewWriter creates the file /path/to/file/name.wav, or /path/to/file/interleaved.wav if no name
+// is provided, and returns a Writer encoding the interleaved frames of the given number of channels
+// in it, as if Interleaved was set. The file is complete once the Writer is closed.
+func (w *Wav) NewWriter(name string, channels int) (*FileWriter, error) {
+	files := w.files(true)
+	return files.create(files.interleavedPath(name), channels)
+}
+
+func (w *Wav) files(interleaved bool) files {
+	sampleRate := w.SampleRate
+	if sampleRate == 0 {
+		sampleRate = mlsic.SampleRate
+	}
+
+	return files{
+		filepath:    w.Filepath,
+		extension:   "wav",
+		interleaved: interleaved,
+		encoder: func(ws io.WriteSeeker, channels int) encoder {
+			wave := newWaveEncoder(ws, sampleRate, channels, w.Encoding)
+			wave.meta = w.Meta
+			wave.extensible = interleaved
+
+			wave.channelMask = w.ChannelMask
+			if wave.channelMask == 0 {
+				wave.channelMask = DefaultChannelMask(channels)
+			}
+
+			if w.Dither {
+				wave.dither = rand.New(rand.NewSource(1))
+			}
+
+			return wave
+		},
+	}
+}
+
+var _ mlsic.Renderer = (*Aiff)(nil)
+
+// Aiff holds relevant information for encoding and saving .aiff files out of audio.PCMBuffer.
+type Aiff struct {
+	// Filepath `/path/to/directory` where the file should be saved.
+	Filepath string
+	// Meta holds file metadata. Title, Artist, Copyright and Comments are written in
+	// their dedicated AIFF chunks, the rest of the fields as annotations.
+	Meta *wav.Metadata
+	// SampleRate of the resulting files. If not set mlsic.SampleRate is used.
+	SampleRate int
+	// Interleaved renders all channels in a single multichannel file
+	// instead of one mono file per channel.
+	Interleaved bool
+	// Encoding is the sample format of the resulting files. Default is Int32.
+	// Float encodings are written as AIFF-C files.
+	Encoding Encoding
+	// Dither adds triangular dither before quantizing to integer encodings.
+	// It is recommended when rendering Int16 files.
+	Dither bool
+}
+
+// Render accepts a slice of audio.PCMBuffer and creates out of each one of them a mono
+// .aiff file named /path/to/file/0.aiff for the first channel, /path/to/file/1.aiff for the second etc.
+// If a filename is provided then the resulting file is /path/to/file/name0.aiff.
+//
+// If Interleaved is set a single file named /path/to/file/name.aiff is created instead,
+// or /path/to/file/interleaved.aiff if no name is provided.
+func (a *Aiff) Render(source []mlsic.Audio, name string) error {
+	files := a.files(a.Interleaved)
+	return files.render(source, name)
+}
+
+// NewWriter creates the file /path/to/file/name.aiff, or /path/to/file/interleaved.aiff if no name
+// is provided, and returns a Writer encoding the interleaved frames of the given number of channels
+// in it, as if Interleaved was set. The file is complete once the Writer is closed.
+func (a *Aiff) NewWriter(name string, channels int) (*FileWriter, error) {
+	files := a.files(true)
+	return files.create(files.interleavedPath(name), channels)
+}
+
+func (a *Aiff) files(interleaved bool) files {
+	sampleRate := a.SampleRate
+	if sampleRate == 0 {
+		sampleRate = mlsic.SampleRate
+	}
+
+	return files{
+		filepath:    a.Filepath,
+		extension:   "aiff",
+		interleaved: interleaved,
+		encoder: func(ws io.WriteSeeker, channels int) encoder {
+			aiff := newAiffEncoder(ws, sampleRate, channels, a.Encoding)
+			aiff.meta = a.Meta
+
+			if a.Dither {
+				aiff.dither = rand.New(rand.NewSource(1))
+			}
+
+			return aiff
+		},
+	}
+}
+
+// encoder is implemented by the file encoders of the package.
+type encoder interface {
+	// write encodes interleaved frames.
+	write(frames []float64) error
+	// close finalizes the file, without closing the underlying writer.
+	close() error
+	// length returns the number of bytes written so far.
+	length() int64
+}
+
+// files holds the common logic of the file renderers, splitting
+// or interleaving the channels in one or more files.
+type files struct {
+	filepath    string
+	extension   string
+	interleaved bool
+	// encoder returns the file encoder for the given number of channels.
+	encoder func(ws io.WriteSeeker, channels int) encoder
+}
+
+func (f *files) render(source []mlsic.Audio, name string) error {
+	if f.interleaved {
+		return f.renderInterleaved(source, name)
+	}
+
 	var wg sync.WaitGroup
 
+	paths := make([]string, len(source))
+	errs := make([]error, len(source))
+
 	for i, source := range source {
+		if name == "" {
+			paths[i] = filepath.Join(f.filepath, fmt.Sprintf("%v.%s", i, f.extension))
+		} else {
+			paths[i] = filepath.Join(f.filepath, fmt.Sprintf("%s%v.%s", name, i, f.extension))
+		}
+
 		wg.Add(1)
 
 		go func(i int, source mlsic.Audio) {
 			defer wg.Done()
 
-			var path string
-			if name == "" {
-				path = filepath.Join(w.Filepath, fmt.Sprintf("%v.wav", i))
-			} else {
-				path = filepath.Join(w.Filepath, fmt.Sprintf("%s%v.wav", name, i))
-			}
-
-			f, err := os.Create(path)
+			err := f.write(paths[i], []mlsic.Audio{source})
 			if err != nil {
-				log.Fatal().Err(err).Int("file", i).Msg("creating file")
+				errs[i] = fmt.Errorf("file %v: %w", i, err)
 			}
+		}(i, source)
+	}
 
-			buf := audio.PCMBuffer{
-				Format:         &audio.Format{NumChannels: 1, SampleRate: 44100},
-				F64:            source,
-				DataType:       audio.DataTypeF64,
-				SourceBitDepth: 1,
-			}
+	wg.Wait()
 
-			f64 := buf.AsFloatBuffer()
-			err = transforms.PCMScale(f64, 32)
-			if err != nil {
-				log.Fatal().Err(err).Int("file", i).Msg("transform")
-			}
+	err := errors.Join(errs...)
+	if err != nil {
+		// Do not leave an incomplete set of files behind.
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}
 
-			intBuf := f64.AsIntBuffer()
+	return err
+}
 
-			wave := wav.NewEncoder(f, buf.Format.SampleRate, 32, 1, 1)
+func (f *files) renderInterleaved(source []mlsic.Audio, name string) error {
+	if len(source) == 0 {
+		return nil
+	}
 
-			if w.Meta != nil {
-				wave.Metadata = w.Meta
-			}
+	for _, channel := range source {
+		if len(channel) != len(source[0]) {
+			return ErrUnevenChannels
+		}
+	}
 
-			err = wave.Write(intBuf)
-			if err != nil {
-				log.Fatal().Err(err).Int("file", i).Msg("writing buf")
-			}
+	return f.write(f.interleavedPath(name), source)
+}
 
-			err = wave.Close()
-			if err != nil {
-				log.Fatal().Err(err).Int("file", i).Msg("closing buffer")
-			}
+// interleavedPath returns the path of the interleaved file named name.
+func (f *files) interleavedPath(name string) string {
+	if name == "" {
+		name = "interleaved"
+	}
 
-			err = f.Close()
-			if err != nil {
-				log.Fatal().Err(err).Int("file", i).Msg("closing file")
+	return filepath.Join(f.filepath, fmt.Sprintf("%s.%s", name, f.extension))
+}
+
+// write encodes source, interleaved, in a new file at path.
+// If anything fails the partially written file is removed.
+func (f *files) write(path string, source []mlsic.Audio) error {
+	w, err := f.create(path, len(source))
+	if err != nil {
+		return err
+	}
+
+	// Interleave and write one buffer at a time.
+	frames := make([]float64, 0, bufferSize*len(source))
+	for i := range source[0] {
+		for _, channel := range source {
+			frames = append(frames, channel[i])
+		}
+
+		if len(frames) == cap(frames) {
+			if _, err := w.Write(frames); err != nil {
+				return err
 			}
 
-			log.Info().Int("file length", wave.WrittenBytes).Int("file", i).Msg("file length")
+			frames = frames[:0]
+		}
+	}
 
-		}(i, source)
+	if _, err := w.Write(frames); err != nil {
+		return err
 	}
 
-	wg.Wait()
+	return w.Close()
+}
 
-	return nil
+// create creates the file at path and returns a FileWriter encoding to it.
+func (f *files) create(path string, channels int) (*FileWriter, error) {
+	if channels < 1 {
+		return nil, mlsic.ErrFrameAlignment
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating file: %w", err)
+	}
+
+	return &FileWriter{
+		path:     path,
+		channels: channels,
+		file:     file,
+		enc:      f.encoder(file, channels),
+	}, nil
 }
 
-// var _ mlsic.Renderer = (*Aiff)(nil)
+var _ mlsic.Writer = (*FileWriter)(nil)
 
-// // Aiff holds relevant information for encoding and saving .aiff files out of audio.PCMBuffer.
-// type Aiff struct {
-// 	// Filepath `/path/to/directory` where the file should be saved.
-// 	Filepath string
-// }
+// FileWriter implements mlsic.Writer encoding a stream of interleaved frames in a single file.
+// If any write fails the partially written file is removed.
+type FileWriter struct {
+	path     string
+	channels int
+	file     *os.File
+	enc      encoder
+	err      error
+}
 
-// // Render accepts a slice of audio.PCMBuffer and creates out of each one of them a mono
-// // .aiff file named /path/to/file/0.aiff for the first channel, /path/to/file/1.aiff for the second etc.
-// func (a *Aiff) Render(readers []mlsic.Reader) error {
-// 	for i, buf := range pcmBuffer {
-// 		f, err := os.Create(filepath.Join(a.Filepath, fmt.Sprintf("%v.aiff", i)))
-// 		if err != nil {
-// 			return err
-// 		}
+// Write implements mlsic.Writer.
+func (w *FileWriter) Write(p mlsic.Audio) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
 
-// 		f32 := buf.AsFloat32Buffer()
+	if len(p)%w.channels != 0 {
+		return 0, mlsic.ErrFrameAlignment
+	}
 
-// 		err = transforms.PCMScaleF32(f32, 32)
-// 		if err != nil {
-// 			return err
-// 		}
+	if err := w.enc.write(p); err != nil {
+		w.fail(fmt.Errorf("writing buf: %w", err))
+		return 0, w.err
+	}
+
+	return len(p), nil
+}
+
+// Close finalizes and closes the file.
+func (w *FileWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
 
-// 		i32 := f32.AsIntBuffer()
-// 		format := pcmBuffer[0].Format
+	if err := w.enc.close(); err != nil {
+		w.fail(fmt.Errorf("closing buffer: %w", err))
+		return w.err
+	}
 
-// 		aiff := aiff.NewEncoder(f, format.SampleRate, 32, 1)
+	// Any further call returns the error below.
+	w.err = ErrClosed
 
-// 		err = aiff.Write(i32)
-// 		if err != nil {
-// 			return err
-// 		}
+	if err := w.file.Close(); err != nil {
+		os.Remove(w.path)
+		return fmt.Errorf("closing file: %w", err)
+	}
 
-// 		err = aiff.Close()
-// 		if err != nil {
-// 			return err
-// 		}
+	log.Info().Int64("file length", w.enc.length()).Int("channels", w.channels).Str("file", w.path).Msg("file length")
 
-// 		err = f.Close()
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
+	return nil
+}
 
-// 	return nil
-// }
+// fail records err and removes the partially written file.
+func (w *FileWriter) fail(err error) {
+	w.err = err
+	w.file.Close()
+	os.Remove(w.path)
+}
@@ -1,12 +1,15 @@
 package render
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/bh90210/mlsic"
+	"github.com/go-audio/aiff"
 	"github.com/go-audio/wav"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,8 +18,7 @@ var testCases = map[string]struct {
 	wav    Wav
 	signal []mlsic.Audio
 
-	// aiff       Aiff
-	// aiffsignal []*audio.PCMBuffer
+	aiff Aiff
 }{
 	"one channel": {
 		wav: Wav{
@@ -26,36 +28,34 @@ var testCases = map[string]struct {
 				Engineer: "bh90210",
 			},
 		},
-		// signal: []*audio.PCMBuffer{
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{-0.5}},
-		// },
 		signal: []mlsic.Audio{[]float64{0, 1, 2, 3}},
 
-		// aiff: Aiff{
-		// 	Filepath: "aiffone",
-		// },
-		// aiffsignal: []*audio.PCMBuffer{
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{-0.5}},
-		// },
+		aiff: Aiff{
+			Filepath: "aiffone",
+		},
 	},
 	"two channels": {
 		wav: Wav{
 			Filepath: "two",
 			Meta:     (*wav.Metadata)(nil),
 		},
-		// signal: []*audio.PCMBuffer{
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{0.5}},
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{0.9}},
-		// },
 		signal: []mlsic.Audio{},
 
-		// aiff: Aiff{
-		// 	Filepath: "aifftwo",
-		// },
-		// aiffsignal: []*audio.PCMBuffer{
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{0.5}},
-		// 	{Format: &audio.Format{NumChannels: 1, SampleRate: 44100}, DataType: audio.DataTypeF32, SourceBitDepth: 32, F32: []float32{0.9}},
-		// },
+		aiff: Aiff{
+			Filepath: "aifftwo",
+		},
+	},
+	"48kHz": {
+		wav: Wav{
+			Filepath:   "rate",
+			SampleRate: 48000,
+		},
+		signal: []mlsic.Audio{[]float64{0, 0.5, -0.5, 0}, []float64{0.25, 0, -0.25, 1}},
+
+		aiff: Aiff{
+			Filepath:   "aiffrate",
+			SampleRate: 48000,
+		},
 	},
 }
 
@@ -83,6 +83,13 @@ func TestWavRenderer(t *testing.T) {
 				dec.ReadMetadata()
 				a.Equal(tc.wav.Meta, dec.Metadata)
 
+				sampleRate := tc.wav.SampleRate
+				if sampleRate == 0 {
+					sampleRate = mlsic.SampleRate
+				}
+
+				a.EqualValues(sampleRate, dec.SampleRate)
+
 				// a.NoError(dec.Rewind())
 				// buf, err := dec.FullPCMBuffer()
 				// a.NoError(err)
@@ -103,45 +110,423 @@ func TestWavRenderer(t *testing.T) {
 	}
 }
 
-// func TestAiffRender(t *testing.T) {
-// 	a := assert.New(t)
+func TestWavInterleaved(t *testing.T) {
+	a := assert.New(t)
 
-// 	for name, tc := range testCases {
-// 		t.Run(name, func(t *testing.T) {
-// 			filePath, err := os.MkdirTemp("", tc.aiff.Filepath)
-// 			a.NoError(err)
+	filePath, err := os.MkdirTemp("", "interleaved")
+	a.NoError(err)
 
-// 			tc.aiff.Filepath = filePath
+	w := Wav{
+		Filepath:    filePath,
+		Interleaved: true,
+		Meta: &wav.Metadata{
+			Software: "Mlsic",
+		},
+	}
+
+	signal := []mlsic.Audio{
+		{0, 0.5, -0.5},
+		{1, -1, 0},
+		{0.25, 0, -0.25},
+	}
+
+	a.NoError(w.Render(signal, "ring"))
 
-// 			err = tc.aiff.Render(tc.aiffsignal)
-// 			a.NoError(err)
+	raw, err := os.ReadFile(filepath.Join(filePath, "ring.wav"))
+	a.NoError(err)
 
-// 			for i := 0; i < len(tc.aiffsignal); i++ {
-// 				aifff := filepath.Join(filePath, fmt.Sprintf("%v.aiff", i))
-// 				f, err := os.Open(aifff)
-// 				a.NoError(err)
+	// WAVE_FORMAT_EXTENSIBLE and the channel mask.
+	a.Equal(uint16(0xFFFE), binary.LittleEndian.Uint16(raw[20:22]))
+	a.Equal(DefaultChannelMask(3), binary.LittleEndian.Uint32(raw[40:44]))
 
-// 				dec := aiff.NewDecoder(f)
-// 				a.NoError(dec.Err())
-// 				a.True(dec.IsValidFile())
+	f, err := os.Open(filepath.Join(filePath, "ring.wav"))
+	a.NoError(err)
+	defer f.Close()
 
-// 				buf, err := dec.FullPCMBuffer()
-// 				a.NoError(err)
-// 				a.NotNil(buf.Data)
+	dec := wav.NewDecoder(f)
+	a.True(dec.IsValidFile())
+	a.EqualValues(3, dec.NumChans)
+	a.EqualValues(32, dec.BitDepth)
+	a.EqualValues(mlsic.SampleRate, dec.SampleRate)
 
-// 				a.EqualValues(tc.aiffsignal[i].SourceBitDepth, buf.SourceBitDepth)
-// 				a.Equal(dec.Format(), buf.PCMFormat())
+	buf, err := dec.FullPCMBuffer()
+	a.NoError(err)
 
-// 				i32 := tc.aiffsignal[i].AsIntBuffer()
-// 				a.NotNil(i32.Data)
+	max := 2147483647.
+	a.Equal([]int{
+		0, int(max), int(math.Round(0.25 * max)),
+		int(math.Round(0.5 * max)), -int(max), 0,
+		-int(math.Round(0.5 * max)), 0, -int(math.Round(0.25 * max)),
+	}, buf.Data)
 
-// 				a.Equal(i32.Data, buf.Data)
+	dec.ReadMetadata()
+	a.Equal(w.Meta, dec.Metadata)
+
+	w.ChannelMask = SpeakerFrontLeft | SpeakerFrontRight | SpeakerLowFrequency
+	a.NoError(w.Render(signal, "mask"))
+
+	raw, err = os.ReadFile(filepath.Join(filePath, "mask.wav"))
+	a.NoError(err)
+	a.Equal(w.ChannelMask, binary.LittleEndian.Uint32(raw[40:44]))
+
+	a.ErrorIs(w.Render([]mlsic.Audio{{0, 1}, {0}}, "uneven"), ErrUnevenChannels)
+}
+
+func TestWavEncodings(t *testing.T) {
+	signal := mlsic.Audio{0, 0.5, -0.5, 0.999, -0.999, 0.123456789, -1, 1}
+
+	tests := map[string]struct {
+		encoding  Encoding
+		dither    bool
+		format    uint16
+		tolerance float64
+	}{
+		"int16":          {encoding: Int16, format: 1, tolerance: 0.5 / 32767},
+		"int16 dithered": {encoding: Int16, dither: true, format: 1, tolerance: 1.5 / 32767},
+		"int24":          {encoding: Int24, format: 1, tolerance: 0.5 / 8388607},
+		"int32":          {encoding: Int32, format: 1, tolerance: 0.5 / 2147483647},
+		"float32":        {encoding: Float32, format: 3, tolerance: 1e-7},
+		"float64":        {encoding: Float64, format: 3, tolerance: 0},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := assert.New(t)
+
+			filePath, err := os.MkdirTemp("", "encoding")
+			a.NoError(err)
+
+			w := Wav{
+				Filepath: filePath,
+				Encoding: tc.encoding,
+				Dither:   tc.dither,
+			}
+
+			// Split mono.
+			a.NoError(w.Render([]mlsic.Audio{signal}, "mono"))
+
+			format, channels, bitDepth, got := readWave(t, filepath.Join(filePath, "mono0.wav"), tc.encoding)
+			a.Equal(tc.format, format)
+			a.Equal(1, channels)
+			a.Equal(tc.encoding.BitDepth(), bitDepth)
+			a.InDeltaSlice([]float64(signal), got, tc.tolerance)
+
+			// Interleaved.
+			w.Interleaved = true
+			a.NoError(w.Render([]mlsic.Audio{signal, signal}, "stereo"))
+
+			format, channels, bitDepth, got = readWave(t, filepath.Join(filePath, "stereo.wav"), tc.encoding)
+			a.Equal(uint16(0xFFFE), format)
+			a.Equal(2, channels)
+			a.Equal(tc.encoding.BitDepth(), bitDepth)
+
+			for i, v := range signal {
+				a.InDelta(v, got[i*2], tc.tolerance)
+				a.InDelta(v, got[i*2+1], tc.tolerance)
+			}
+		})
+	}
+}
 
-// 				a.Equal(tc.aiffsignal[i].Format, dec.Format())
+// readWave parses a .wav file and returns its format tag, number of channels,
+// bit depth and the samples of the data chunk scaled back to -1.0 to 1.0.
+func readWave(t *testing.T, path string, encoding Encoding) (uint16, int, int, []float64) {
+	raw, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "RIFF", string(raw[0:4]))
+	assert.Equal(t, "WAVE", string(raw[8:12]))
+	assert.EqualValues(t, len(raw)-8, binary.LittleEndian.Uint32(raw[4:8]))
 
-// 				a.NoError(dec.Rewind())
-// 				a.NoError(f.Close())
-// 			}
-// 		})
-// 	}
-// }
+	var format uint16
+	var channels, bitDepth int
+	var samples []float64
+
+	for pos := 12; pos+8 <= len(raw); {
+		id := string(raw[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(raw[pos+4 : pos+8]))
+		chunk := raw[pos+8 : pos+8+size]
+
+		switch id {
+		case "fmt ":
+			format = binary.LittleEndian.Uint16(chunk[0:2])
+			channels = int(binary.LittleEndian.Uint16(chunk[2:4]))
+			bitDepth = int(binary.LittleEndian.Uint16(chunk[14:16]))
+
+		case "data":
+			step := bitDepth / 8
+			max := math.Pow(2, float64(bitDepth-1)) - 1
+
+			for i := 0; i+step <= len(chunk); i += step {
+				s := chunk[i : i+step]
+
+				switch encoding {
+				case Int16:
+					samples = append(samples, float64(int16(binary.LittleEndian.Uint16(s)))/max)
+
+				case Int24:
+					v := int32(uint32(s[0])<<8|uint32(s[1])<<16|uint32(s[2])<<24) >> 8
+					samples = append(samples, float64(v)/max)
+
+				case Int32:
+					samples = append(samples, float64(int32(binary.LittleEndian.Uint32(s)))/max)
+
+				case Float32:
+					samples = append(samples, float64(math.Float32frombits(binary.LittleEndian.Uint32(s))))
+
+				case Float64:
+					samples = append(samples, math.Float64frombits(binary.LittleEndian.Uint64(s)))
+				}
+			}
+		}
+
+		pos += 8 + size + size%2
+	}
+
+	return format, channels, bitDepth, samples
+}
+
+func TestAiffRender(t *testing.T) {
+	a := assert.New(t)
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			filePath, err := os.MkdirTemp("", tc.aiff.Filepath)
+			a.NoError(err)
+
+			tc.aiff.Filepath = filePath
+
+			err = tc.aiff.Render(tc.signal, "")
+			a.NoError(err)
+
+			sampleRate := tc.aiff.SampleRate
+			if sampleRate == 0 {
+				sampleRate = mlsic.SampleRate
+			}
+
+			for i := 0; i < len(tc.signal); i++ {
+				f, err := os.Open(filepath.Join(filePath, fmt.Sprintf("%v.aiff", i)))
+				a.NoError(err)
+
+				dec := aiff.NewDecoder(f)
+				a.True(dec.IsValidFile())
+
+				buf, err := dec.FullPCMBuffer()
+				a.NoError(err)
+
+				a.EqualValues(1, dec.NumChans)
+				a.EqualValues(32, dec.BitDepth)
+				a.Equal(sampleRate, dec.SampleRate)
+				a.Len(buf.Data, len(tc.signal[i]))
+
+				for o, v := range tc.signal[i] {
+					a.InDelta(math.Max(-1, math.Min(1, v)), float64(buf.Data[o])/2147483647, 1e-9)
+				}
+
+				a.NoError(f.Close())
+			}
+		})
+	}
+}
+
+func TestAiffInterleaved(t *testing.T) {
+	a := assert.New(t)
+
+	filePath, err := os.MkdirTemp("", "aiffinterleaved")
+	a.NoError(err)
+
+	r := Aiff{
+		Filepath:    filePath,
+		Interleaved: true,
+		Encoding:    Int24,
+		Meta: &wav.Metadata{
+			Title:    "Ring",
+			Artist:   "bh90210",
+			Software: "Mlsic",
+		},
+	}
+
+	signal := []mlsic.Audio{
+		{0, 0.5, -0.5},
+		{1, -1, 0},
+		{0.25, 0, -0.25},
+	}
+
+	a.NoError(r.Render(signal, "ring"))
+
+	f, err := os.Open(filepath.Join(filePath, "ring.aiff"))
+	a.NoError(err)
+	defer f.Close()
+
+	dec := aiff.NewDecoder(f)
+	a.True(dec.IsValidFile())
+
+	buf, err := dec.FullPCMBuffer()
+	a.NoError(err)
+	a.EqualValues(3, dec.NumChans)
+	a.EqualValues(24, dec.BitDepth)
+
+	max := 8388607.
+	for i := range signal[0] {
+		for channel := range signal {
+			a.InDelta(signal[channel][i], float64(buf.Data[i*3+channel])/max, 0.5/max)
+		}
+	}
+
+	chunks := readAiffChunks(t, filepath.Join(filePath, "ring.aiff"))
+	a.Equal("Ring", string(chunks["NAME"][0]))
+	a.Equal("bh90210", string(chunks["AUTH"][0]))
+	a.Equal("Software: Mlsic", string(chunks["ANNO"][0]))
+}
+
+func TestAiffFloat(t *testing.T) {
+	a := assert.New(t)
+
+	filePath, err := os.MkdirTemp("", "aifffloat")
+	a.NoError(err)
+
+	signal := mlsic.Audio{0, 0.5, -0.5, 0.123456789, -1, 1}
+
+	for _, encoding := range []Encoding{Float32, Float64} {
+		r := Aiff{
+			Filepath: filePath,
+			Encoding: encoding,
+		}
+
+		name := fmt.Sprintf("float%v", encoding.BitDepth())
+		a.NoError(r.Render([]mlsic.Audio{signal}, name))
+
+		path := filepath.Join(filePath, name+"0.aiff")
+		raw, err := os.ReadFile(path)
+		a.NoError(err)
+		a.Equal("AIFC", string(raw[8:12]))
+		a.EqualValues(len(raw)-8, binary.BigEndian.Uint32(raw[4:8]))
+
+		chunks := readAiffChunks(t, path)
+		comm := chunks["COMM"][0]
+		a.EqualValues(1, binary.BigEndian.Uint16(comm[0:2]))
+		a.EqualValues(len(signal), binary.BigEndian.Uint32(comm[2:6]))
+		a.EqualValues(encoding.BitDepth(), binary.BigEndian.Uint16(comm[6:8]))
+
+		// Skip offset and block size.
+		data := chunks["SSND"][0][8:]
+		for i, v := range signal {
+			switch encoding {
+			case Float32:
+				a.InDelta(v, float64(math.Float32frombits(binary.BigEndian.Uint32(data[i*4:]))), 1e-7)
+
+			case Float64:
+				a.Equal(v, math.Float64frombits(binary.BigEndian.Uint64(data[i*8:])))
+			}
+		}
+	}
+}
+
+// readAiffChunks returns the content of all the chunks of an .aiff file by id.
+func readAiffChunks(t *testing.T, path string) map[string][][]byte {
+	raw, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "FORM", string(raw[0:4]))
+
+	chunks := make(map[string][][]byte)
+	for pos := 12; pos+8 <= len(raw); {
+		id := string(raw[pos : pos+4])
+		size := int(binary.BigEndian.Uint32(raw[pos+4 : pos+8]))
+
+		chunks[id] = append(chunks[id], raw[pos+8:pos+8+size])
+
+		pos += 8 + size + size%2
+	}
+
+	return chunks
+}
+
+func TestRenderErrors(t *testing.T) {
+	a := assert.New(t)
+
+	signal := []mlsic.Audio{
+		{0, 0.5, -0.5},
+		{1, -1, 0},
+	}
+
+	w := Wav{Filepath: filepath.Join(os.TempDir(), "mlsic-missing", "directory")}
+	err := w.Render(signal, "")
+	a.ErrorIs(err, os.ErrNotExist)
+	a.ErrorContains(err, "file 0")
+	a.ErrorContains(err, "file 1")
+
+	filePath, err := os.MkdirTemp("", "errors")
+	a.NoError(err)
+
+	// A directory in place of the second file makes its creation fail.
+	a.NoError(os.Mkdir(filepath.Join(filePath, "partial1.wav"), 0755))
+
+	w = Wav{Filepath: filePath}
+	err = w.Render(signal, "partial")
+	a.Error(err)
+	a.NotContains(err.Error(), "file 0")
+
+	// The successfully rendered first file should be cleaned up too.
+	a.NoFileExists(filepath.Join(filePath, "partial0.wav"))
+
+	aiff := Aiff{Filepath: filepath.Join(os.TempDir(), "mlsic-missing", "directory"), Interleaved: true}
+	a.ErrorIs(aiff.Render(signal, ""), os.ErrNotExist)
+}
+
+func TestFileWriter(t *testing.T) {
+	a := assert.New(t)
+
+	filePath, err := os.MkdirTemp("", "writer")
+	a.NoError(err)
+
+	signal := []mlsic.Audio{
+		make(mlsic.Audio, 3*bufferSize+7),
+		make(mlsic.Audio, 3*bufferSize+7),
+	}
+
+	for i := range signal[0] {
+		signal[0][i] = math.Sin(float64(i))
+		signal[1][i] = math.Cos(float64(i))
+	}
+
+	w := Wav{
+		Filepath:    filePath,
+		Interleaved: true,
+		Encoding:    Int24,
+	}
+
+	aiff := Aiff{
+		Filepath:    filePath,
+		Interleaved: true,
+		Encoding:    Float32,
+	}
+
+	for _, r := range []interface {
+		mlsic.Renderer
+		NewWriter(string, int) (*FileWriter, error)
+	}{&w, &aiff} {
+		a.NoError(r.Render(signal, "rendered"))
+
+		writer, err := r.NewWriter("streamed", len(signal))
+		a.NoError(err)
+
+		written, err := mlsic.Copy(writer, mlsic.NewAudioReader(signal))
+		a.NoError(err)
+		a.EqualValues(2*len(signal[0]), written)
+
+		_, err = writer.Write(mlsic.Audio{0})
+		a.ErrorIs(err, mlsic.ErrFrameAlignment)
+
+		a.NoError(writer.Close())
+		a.ErrorIs(writer.Close(), ErrClosed)
+	}
+
+	for _, extension := range []string{"wav", "aiff"} {
+		rendered, err := os.ReadFile(filepath.Join(filePath, "rendered."+extension))
+		a.NoError(err)
+
+		streamed, err := os.ReadFile(filepath.Join(filePath, "streamed."+extension))
+		a.NoError(err)
+
+		a.Equal(rendered, streamed, extension)
+	}
+}
@@ -0,0 +1,328 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+
+	"github.com/go-audio/wav"
+)
+
+// Speaker positions used to build the channel mask of WAVE_FORMAT_EXTENSIBLE files.
+const (
+	SpeakerFrontLeft uint32 = 1 << iota
+	SpeakerFrontRight
+	SpeakerFrontCenter
+	SpeakerLowFrequency
+	SpeakerBackLeft
+	SpeakerBackRight
+	SpeakerFrontLeftOfCenter
+	SpeakerFrontRightOfCenter
+	SpeakerBackCenter
+	SpeakerSideLeft
+	SpeakerSideRight
+)
+
+// DefaultChannelMask returns the conventional speaker mask for the given number of channels.
+// Channel counts without a common speaker arrangement return zero, meaning that
+// channels are not assigned to any particular speaker position.
+func DefaultChannelMask(channels int) uint32 {
+	switch channels {
+	case 1:
+		return SpeakerFrontCenter
+
+	case 2:
+		return SpeakerFrontLeft | SpeakerFrontRight
+
+	case 3:
+		return SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter
+
+	case 4:
+		return SpeakerFrontLeft | SpeakerFrontRight | SpeakerBackLeft | SpeakerBackRight
+
+	case 5:
+		return SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter | SpeakerBackLeft | SpeakerBackRight
+
+	case 6:
+		return SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter | SpeakerLowFrequency |
+			SpeakerBackLeft | SpeakerBackRight
+
+	case 8:
+		return SpeakerFrontLeft | SpeakerFrontRight | SpeakerFrontCenter | SpeakerLowFrequency |
+			SpeakerBackLeft | SpeakerBackRight | SpeakerSideLeft | SpeakerSideRight
+
+	default:
+		return 0
+	}
+}
+
+const (
+	waveFormatPCM        = 0x0001
+	waveFormatIEEEFloat  = 0x0003
+	waveFormatExtensible = 0xFFFE
+)
+
+var (
+	// subFormatPCM is the KSDATAFORMAT_SUBTYPE_PCM GUID.
+	subFormatPCM = [16]byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+	// subFormatIEEEFloat is the KSDATAFORMAT_SUBTYPE_IEEE_FLOAT GUID.
+	subFormatIEEEFloat = [16]byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+)
+
+// ErrUnevenChannels is returned when the channels of an interleaved render have different lengths.
+var ErrUnevenChannels = errors.New("all channels must have the same length")
+
+// waveEncoder writes interleaved float64 frames as a .wav file.
+// Unlike wav.Encoder it can write WAVE_FORMAT_EXTENSIBLE headers.
+type waveEncoder struct {
+	w io.WriteSeeker
+
+	sampleRate  int
+	channels    int
+	encoding    Encoding
+	extensible  bool
+	channelMask uint32
+	meta        *wav.Metadata
+	// dither is the source of the triangular dither noise added before
+	// quantizing to integer samples. Dither is disabled when nil.
+	dither *rand.Rand
+
+	frames       int
+	written      int64
+	dataSizePos  int64
+	factFramePos int64
+	wroteHeader  bool
+	buf          bytes.Buffer
+}
+
+func newWaveEncoder(w io.WriteSeeker, sampleRate, channels int, encoding Encoding) *waveEncoder {
+	return &waveEncoder{
+		w:          w,
+		sampleRate: sampleRate,
+		channels:   channels,
+		encoding:   encoding,
+	}
+}
+
+func (e *waveEncoder) add(src any) error {
+	e.written += int64(binary.Size(src))
+	return binary.Write(e.w, binary.LittleEndian, src)
+}
+
+func (e *waveEncoder) writeHeader() error {
+	e.wroteHeader = true
+
+	bitDepth := e.encoding.BitDepth()
+	blockAlign := e.channels * bitDepth / 8
+
+	fmtSize := uint32(16)
+	format := uint16(waveFormatPCM)
+	subFormat := subFormatPCM
+
+	if e.encoding.IsFloat() {
+		// Non PCM formats carry a (zero) extension size.
+		fmtSize = 18
+		format = waveFormatIEEEFloat
+		subFormat = subFormatIEEEFloat
+	}
+
+	if e.extensible {
+		fmtSize = 40
+		format = waveFormatExtensible
+	}
+
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		// File size, updated on close.
+		uint32(0),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		fmtSize,
+		format,
+		uint16(e.channels),
+		uint32(e.sampleRate),
+		uint32(e.sampleRate * blockAlign),
+		uint16(blockAlign),
+		uint16(bitDepth),
+	}
+
+	switch {
+	case e.extensible:
+		header = append(header,
+			// Size of the extension.
+			uint16(22),
+			// Valid bits per sample.
+			uint16(bitDepth),
+			e.channelMask,
+			subFormat,
+		)
+
+	case e.encoding.IsFloat():
+		header = append(header, uint16(0))
+	}
+
+	for _, v := range header {
+		if err := e.add(v); err != nil {
+			return err
+		}
+	}
+
+	// Non PCM files need a fact chunk holding the number of frames.
+	if e.encoding.IsFloat() {
+		if err := e.add([4]byte{'f', 'a', 'c', 't'}); err != nil {
+			return err
+		}
+
+		if err := e.add(uint32(4)); err != nil {
+			return err
+		}
+
+		e.factFramePos = e.written
+
+		// Number of frames, updated on close.
+		if err := e.add(uint32(0)); err != nil {
+			return err
+		}
+	}
+
+	if err := e.add([4]byte{'d', 'a', 't', 'a'}); err != nil {
+		return err
+	}
+
+	e.dataSizePos = e.written
+
+	// Data size, updated on close.
+	return e.add(uint32(0))
+}
+
+// write encodes interleaved frames. len(frames) must be a multiple of the number of channels.
+func (e *waveEncoder) write(frames []float64) error {
+	if !e.wroteHeader {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	e.buf.Reset()
+	encodeSamples(&e.buf, binary.LittleEndian, e.encoding, e.dither, frames)
+
+	n, err := e.w.Write(e.buf.Bytes())
+	e.written += int64(n)
+	e.frames += len(frames) / e.channels
+
+	return err
+}
+
+// length returns the number of bytes written so far.
+func (e *waveEncoder) length() int64 {
+	return e.written
+}
+
+// close writes the metadata and updates the chunk sizes.
+// Note that the underlying writer is not closed.
+func (e *waveEncoder) close() error {
+	if !e.wroteHeader {
+		if err := e.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	dataSize := e.written - e.dataSizePos - 4
+	// Chunks must be word aligned.
+	if dataSize%2 == 1 {
+		if err := e.add(uint8(0)); err != nil {
+			return err
+		}
+	}
+
+	if e.meta != nil {
+		info := infoChunk(e.meta)
+		if err := e.add([4]byte{'L', 'I', 'S', 'T'}); err != nil {
+			return err
+		}
+
+		if err := e.add(uint32(len(info))); err != nil {
+			return err
+		}
+
+		if err := e.add(info); err != nil {
+			return err
+		}
+	}
+
+	if _, err := e.w.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := binary.Write(e.w, binary.LittleEndian, uint32(e.written-8)); err != nil {
+		return err
+	}
+
+	if _, err := e.w.Seek(e.dataSizePos, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err := binary.Write(e.w, binary.LittleEndian, uint32(dataSize)); err != nil {
+		return err
+	}
+
+	if e.factFramePos > 0 {
+		if _, err := e.w.Seek(e.factFramePos, io.SeekStart); err != nil {
+			return err
+		}
+
+		if err := binary.Write(e.w, binary.LittleEndian, uint32(e.frames)); err != nil {
+			return err
+		}
+	}
+
+	_, err := e.w.Seek(0, io.SeekEnd)
+	return err
+}
+
+// infoChunk encodes metadata as the content of a LIST INFO chunk.
+func infoChunk(meta *wav.Metadata) []byte {
+	buf := bytes.NewBufferString("INFO")
+
+	sections := []struct {
+		id    string
+		value string
+	}{
+		{"IART", meta.Artist},
+		{"ICMT", meta.Comments},
+		{"ICOP", meta.Copyright},
+		{"ICRD", meta.CreationDate},
+		{"IENG", meta.Engineer},
+		{"ITCH", meta.Technician},
+		{"IGNR", meta.Genre},
+		{"IKEY", meta.Keywords},
+		{"IMED", meta.Medium},
+		{"INAM", meta.Title},
+		{"IPRD", meta.Product},
+		{"ISBJ", meta.Subject},
+		{"ISFT", meta.Software},
+		{"ISRC", meta.Source},
+		{"IARL", meta.Location},
+		{"ITRK", meta.TrackNbr},
+	}
+
+	for _, s := range sections {
+		if s.value == "" {
+			continue
+		}
+
+		value := append([]byte(s.value), 0x00)
+
+		buf.WriteString(s.id)
+		binary.Write(buf, binary.LittleEndian, uint32(len(value)))
+		buf.Write(value)
+
+		if len(value)%2 == 1 {
+			buf.WriteByte(0x00)
+		}
+	}
+
+	return buf.Bytes()
+}
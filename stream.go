@@ -0,0 +1,177 @@
+package mlsic
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrFrameAlignment is returned when a buffer does not hold a whole number of frames.
+var ErrFrameAlignment = errors.New("buffer length must be a multiple of the number of channels")
+
+// copyBufferSize is the number of samples Copy and ReadAll move at a time.
+const copyBufferSize = 8192
+
+// Interleave merges the channels in a single slice of frames.
+// Channels shorter than the longest one are padded with silence.
+func Interleave(channels []Audio) Audio {
+	var length int
+	for _, c := range channels {
+		if len(c) > length {
+			length = len(c)
+		}
+	}
+
+	frames := make(Audio, length*len(channels))
+	for ch, c := range channels {
+		for i, v := range c {
+			frames[i*len(channels)+ch] = v
+		}
+	}
+
+	return frames
+}
+
+// Deinterleave splits frames to the given number of channels.
+// It is the inverse of Interleave.
+func Deinterleave(frames Audio, channels int) []Audio {
+	split := make([]Audio, channels)
+	if channels < 1 {
+		return split
+	}
+
+	for ch := range split {
+		split[ch] = make(Audio, len(frames)/channels)
+	}
+
+	for i := range split[0] {
+		for ch := range split {
+			split[ch][i] = frames[i*channels+ch]
+		}
+	}
+
+	return split
+}
+
+var _ Reader = (*AudioReader)(nil)
+
+// AudioReader implements Reader streaming already generated channels.
+type AudioReader struct {
+	source []Audio
+	length int
+	pos    int
+}
+
+// NewAudioReader returns a Reader streaming source interleaved.
+// Channels shorter than the longest one are padded with silence.
+func NewAudioReader(source []Audio) *AudioReader {
+	var length int
+	for _, c := range source {
+		if len(c) > length {
+			length = len(c)
+		}
+	}
+
+	return &AudioReader{
+		source: source,
+		length: length,
+	}
+}
+
+// Channels returns the number of channels of the stream.
+func (r *AudioReader) Channels() int {
+	return len(r.source)
+}
+
+// Length returns the length of the stream in frames.
+func (r *AudioReader) Length() int {
+	return r.length
+}
+
+// Read implements Reader.
+func (r *AudioReader) Read(p Audio) (int, error) {
+	if r.pos >= r.length || len(r.source) == 0 {
+		return 0, io.EOF
+	}
+
+	frames := min(len(p)/len(r.source), r.length-r.pos)
+	if frames == 0 {
+		return 0, io.ErrShortBuffer
+	}
+
+	for i := 0; i < frames; i++ {
+		for ch, c := range r.source {
+			var v float64
+			if r.pos+i < len(c) {
+				v = c[r.pos+i]
+			}
+
+			p[i*len(r.source)+ch] = v
+		}
+	}
+
+	r.pos += frames
+
+	return frames * len(r.source), nil
+}
+
+// Copy copies from src to dst until src returns io.EOF or an error occurs.
+// It returns the number of samples copied.
+func Copy(dst Writer, src Reader) (written int64, err error) {
+	buf := make(Audio, copyBufferSize)
+
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			w, werr := dst.Write(buf[:n])
+			written += int64(w)
+
+			if werr != nil {
+				return written, werr
+			}
+
+			if w != n {
+				return written, io.ErrShortWrite
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// ReadAll reads r until io.EOF and returns the stream split to the given number of channels.
+func ReadAll(r Reader, channels int) ([]Audio, error) {
+	if channels < 1 {
+		return nil, ErrFrameAlignment
+	}
+
+	// Make room for a whole number of frames.
+	buf := make(Audio, max(copyBufferSize/channels, 1)*channels)
+	split := make([]Audio, channels)
+
+	for {
+		n, err := r.Read(buf)
+		if n%channels != 0 {
+			return split, ErrFrameAlignment
+		}
+
+		for i := 0; i < n; i += channels {
+			for ch := range split {
+				split[ch] = append(split[ch], buf[i+ch])
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return split, nil
+		}
+
+		if err != nil {
+			return split, err
+		}
+	}
+}
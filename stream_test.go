@@ -0,0 +1,77 @@
+package mlsic
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterleave(t *testing.T) {
+	a := assert.New(t)
+
+	channels := []Audio{{1, 2, 3}, {4, 5}}
+
+	frames := Interleave(channels)
+	a.Equal(Audio{1, 4, 2, 5, 3, 0}, frames)
+
+	a.Equal([]Audio{{1, 2, 3}, {4, 5, 0}}, Deinterleave(frames, 2))
+}
+
+// audioWriter collects everything written to it.
+type audioWriter struct {
+	frames Audio
+}
+
+func (w *audioWriter) Write(p Audio) (int, error) {
+	w.frames = append(w.frames, p...)
+	return len(p), nil
+}
+
+func TestAudioReader(t *testing.T) {
+	a := assert.New(t)
+
+	source := []Audio{{1, 2, 3, 4, 5}, {6, 7, 8}}
+
+	r := NewAudioReader(source)
+	a.Equal(2, r.Channels())
+	a.Equal(5, r.Length())
+
+	// Odd sized buffers only get whole frames.
+	buf := make(Audio, 5)
+	n, err := r.Read(buf)
+	a.NoError(err)
+	a.Equal(4, n)
+	a.Equal(Audio{1, 6, 2, 7}, buf[:n])
+
+	n, err = r.Read(buf[:1])
+	a.ErrorIs(err, io.ErrShortBuffer)
+	a.Zero(n)
+
+	w := &audioWriter{}
+	written, err := Copy(w, r)
+	a.NoError(err)
+	a.EqualValues(6, written)
+	a.Equal(Audio{3, 8, 4, 0, 5, 0}, w.frames)
+
+	n, err = r.Read(buf)
+	a.ErrorIs(err, io.EOF)
+	a.Zero(n)
+}
+
+func TestReadAll(t *testing.T) {
+	a := assert.New(t)
+
+	source := []Audio{make(Audio, copyBufferSize), make(Audio, copyBufferSize)}
+	for i := range source[0] {
+		source[0][i] = float64(i)
+		source[1][i] = -float64(i)
+	}
+
+	got, err := ReadAll(NewAudioReader(source), 2)
+	a.NoError(err)
+	a.Equal(source, got)
+
+	_, err = ReadAll(NewAudioReader(source), 0)
+	a.ErrorIs(err, ErrFrameAlignment)
+}